@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// file range mapped to an address range, i.e. a segment
+type AddrRange struct {
+	Offset int64
+	Size   int64
+	Addr   int64
+}
+
+var (
+	addrMap       []AddrRange // sorted by offset, replaces base/baseMult within the ranges
+	addrMapSource string      // "auto" for the executable's segments, or a map file name
+	exeAddrMap    []AddrRange // segments of the opened executable, filled by loadSymbols()
+	addrMapFlag   string
+)
+
+// address of a mapped file offset
+func mapOffset(off int64) (int64, bool) {
+	i := sort.Search(len(addrMap), func(i int) bool { return addrMap[i].Offset+addrMap[i].Size > off })
+	if i < len(addrMap) && off >= addrMap[i].Offset {
+		return addrMap[i].Addr + off - addrMap[i].Offset, true
+	}
+	return 0, false
+}
+
+// file offset of a mapped address
+func mapAddr(ea int64) (int64, bool) {
+	for _, r := range addrMap {
+		if ea >= r.Addr && ea-r.Addr < r.Size {
+			return r.Offset + ea - r.Addr, true
+		}
+	}
+	return 0, false
+}
+
+// checks and sorts the ranges, clipping them to the file
+func setAddrMap(ranges []AddrRange, source string) error {
+	m := make([]AddrRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Offset < 0 || r.Size < 0 || r.Offset >= fileSize {
+			return fmt.Errorf("range %X+%X is outside of the file", r.Offset, r.Size)
+		}
+		r.Size = min64(r.Size, fileSize-r.Offset)
+		if r.Size > 0 {
+			m = append(m, r)
+		}
+	}
+	sort.Slice(m, func(i, j int) bool { return m[i].Offset < m[j].Offset })
+	for i := 1; i < len(m); i++ {
+		if m[i].Offset < m[i-1].Offset+m[i-1].Size {
+			return fmt.Errorf("ranges %X and %X overlap in the file", m[i-1].Offset, m[i].Offset)
+		}
+	}
+	addrMap, addrMapSource = m, source
+	if len(m) == 0 {
+		addrMapSource = ""
+	}
+	calcOffsetWidth()
+	return nil
+}
+
+// "auto" for the segments of the executable, or a text file with "offset size address" lines in hex
+func loadAddrMap(source string) error {
+	if source == "auto" {
+		if len(exeAddrMap) == 0 {
+			return fmt.Errorf("no segments: not an ELF/PE/Mach-O file")
+		}
+		// segments may share a page in the file, the later one wins
+		m := append([]AddrRange(nil), exeAddrMap...)
+		sort.Slice(m, func(i, j int) bool { return m[i].Offset < m[j].Offset })
+		for i := 1; i < len(m); i++ {
+			if m[i-1].Offset+m[i-1].Size > m[i].Offset {
+				m[i-1].Size = m[i].Offset - m[i-1].Offset
+			}
+		}
+		return setAddrMap(m, source)
+	}
+
+	// the session keeps the map file name
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ranges := make([]AddrRange, 0)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		a := strings.Fields(line)
+		if len(a) != 3 {
+			return fmt.Errorf("%s:%d: need <offset> <size> <address>", source, n)
+		}
+		var v [3]int64
+		for i := range v {
+			if v[i], err = parseExprRadix(a[i], 16); err != nil {
+				return fmt.Errorf("%s:%d: %w", source, n, err)
+			}
+		}
+		ranges = append(ranges, AddrRange{v[0], v[1], v[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return setAddrMap(ranges, source)
+}
+
+// width of the offset column, enough for mapped addresses
+func calcOffsetWidth() {
+	offsetWidth = max32(len(fmt.Sprintf("%X", fileSize)), 8)
+	for _, r := range addrMap {
+		offsetWidth = max32(offsetWidth, len(fmt.Sprintf("%X", r.Addr+r.Size-1)))
+	}
+	if screen != nil && !customColsMode {
+		calcDefaultCols(scrWidth)
+	}
+}
+
+func addrMapLine(r AddrRange) string {
+	return fmt.Sprintf("%0*X-%0*X  ->  %0*X-%0*X", offsetWidth, r.Offset, offsetWidth, r.Offset+r.Size,
+		offsetWidth, r.Addr, offsetWidth, r.Addr+r.Size)
+}
+
+// addrmap [auto | <file> | off]
+func cmd_addrmap(args string) {
+	switch args = strings.TrimSpace(args); args {
+	case "":
+		if len(addrMap) == 0 {
+			showMsg("no address map, offsets are base + offset*baseMult")
+			return
+		}
+		panel := &ListPanel{
+			Title: "address map: " + addrMapSource,
+			Len:   func() int { return len(addrMap) },
+			Line:  func(i int) string { return addrMapLine(addrMap[i]) },
+			Keys:  "enter: go  esc: close",
+		}
+		if i := panel.Run(func(*tcell.EventKey, int) bool { return false }); i >= 0 {
+			pushBreadcrumb(-1)
+			setCursor(addrMap[i].Offset)
+		}
+	case "off":
+		setAddrMap(nil, "")
+	default:
+		if err := loadAddrMap(args); err != nil {
+			showError(err)
+			return
+		}
+		showMsg(fmt.Sprintf("%d ranges mapped", len(addrMap)))
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const MAX_AHO_NODES = 65536 // the automaton takes 1 KiB per node
+
+// Aho-Corasick automaton finding any of the patterns in a single pass
+type ahoMatcher struct {
+	names  []string // human-readable patterns
+	lens   []int
+	delta  []int32 // delta[state*256+c] = next state
+	pat    []int32 // pattern ending at the state, -1 if none
+	dict   []int32 // next state on the suffix chain with a pattern, -1 if none
+	maxLen int
+}
+
+func newAhoMatcher(src string) (*ahoMatcher, error) {
+	patterns, names, err := parseMultiPatterns(src)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ahoMatcher{names: names}
+	m.addState()
+
+	// trie
+	for id, p := range patterns {
+		state := int32(0)
+		for _, c := range p {
+			next := m.delta[int(state)*256+int(c)]
+			if next == 0 {
+				if len(m.pat) >= MAX_AHO_NODES {
+					return nil, errors.New("too many patterns")
+				}
+				next = m.addState()
+				m.delta[int(state)*256+int(c)] = next
+			}
+			state = next
+		}
+		if m.pat[state] == -1 {
+			m.pat[state] = int32(id)
+		}
+		m.lens = append(m.lens, len(p))
+		if len(p) > m.maxLen {
+			m.maxLen = len(p)
+		}
+	}
+
+	// failure links, breadth-first, turning the trie into a DFA
+	fail := make([]int32, len(m.pat))
+	queue := make([]int32, 0, len(m.pat))
+	for c := 0; c < 256; c++ {
+		if next := m.delta[c]; next != 0 {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		f := fail[state]
+		if m.pat[f] != -1 {
+			m.dict[state] = f
+		} else {
+			m.dict[state] = m.dict[f]
+		}
+
+		for c := 0; c < 256; c++ {
+			i := int(state)*256 + c
+			if next := m.delta[i]; next != 0 {
+				fail[next] = m.delta[int(f)*256+c]
+				queue = append(queue, next)
+			} else {
+				m.delta[i] = m.delta[int(f)*256+c]
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m *ahoMatcher) addState() int32 {
+	m.delta = append(m.delta, make([]int32, 256)...)
+	m.pat = append(m.pat, -1)
+	m.dict = append(m.dict, -1)
+	return int32(len(m.pat) - 1)
+}
+
+// first state on the suffix chain of state with a pattern, i.e. the longest match ending here
+func (m *ahoMatcher) output(state int32) int32 {
+	if m.pat[state] != -1 {
+		return state
+	}
+	return m.dict[state]
+}
+
+func (m *ahoMatcher) Index(buf []byte) (int, int) {
+	best, bestLen := -1, 0
+	state := int32(0)
+	for i, c := range buf {
+		// a match starting before the best one can't end after best+maxLen
+		if best != -1 && i >= best+m.maxLen {
+			break
+		}
+		state = m.delta[int(state)*256+int(c)]
+		if s := m.output(state); s != -1 {
+			id := m.pat[s]
+			if start := i + 1 - m.lens[id]; best == -1 || start < best {
+				best, bestLen = start, m.lens[id]
+			}
+		}
+	}
+	return best, bestLen
+}
+
+func (m *ahoMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	if end := limit + m.maxLen - 1; end < len(buf) {
+		buf = buf[:end]
+	}
+	best, bestLen := -1, 0
+	state := int32(0)
+	for i, c := range buf {
+		state = m.delta[int(state)*256+int(c)]
+		// suffix chain goes from longer to shorter patterns, i.e. to later starts
+		for s := m.output(state); s != -1; s = m.dict[s] {
+			id := m.pat[s]
+			start := i + 1 - m.lens[id]
+			if start >= limit {
+				break
+			}
+			if start > best {
+				best, bestLen = start, m.lens[id]
+			}
+		}
+	}
+	return best, bestLen
+}
+
+func (m *ahoMatcher) MaxLen() int {
+	return m.maxLen
+}
+
+// longest pattern at the start of buf.
+// The matcher keeps no state, as it's shared by the search workers
+func (m *ahoMatcher) DescribeMatch(buf []byte) string {
+	best := -1
+	state := int32(0)
+	for i, c := range buf {
+		state = m.delta[int(state)*256+int(c)]
+		for s := m.output(state); s != -1; s = m.dict[s] {
+			if id := m.pat[s]; m.lens[id] == i+1 {
+				best = int(id)
+				break
+			}
+		}
+	}
+	if best == -1 {
+		return ""
+	}
+	return m.names[best]
+}
+
+// parses a list of patterns separated by ',' or ';':
+// hex bytes, "quoted text" with Go escapes, @history for hex/text patterns from the search history,
+// or @file to read patterns from a file, one per line
+func parseMultiPatterns(src string) ([][]byte, []string, error) {
+	patterns := make([][]byte, 0)
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(p []byte, name string) {
+		if len(p) > 0 && !seen[string(p)] {
+			seen[string(p)] = true
+			patterns = append(patterns, p)
+			names = append(names, name)
+		}
+	}
+
+	err := parsePatternList(src, add, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, nil, errors.New("empty pattern list")
+	}
+	return patterns, names, nil
+}
+
+func parsePatternList(src string, add func([]byte, string), allowFiles bool) error {
+	for {
+		src = strings.TrimLeft(src, " \t,;")
+		if src == "" {
+			return nil
+		}
+
+		switch src[0] {
+		case '"', '`':
+			quoted, err := strconv.QuotedPrefix(src)
+			if err != nil {
+				return fmt.Errorf("invalid string: %s", src)
+			}
+			text, _ := strconv.Unquote(quoted)
+			add([]byte(text), quoted)
+			src = src[len(quoted):]
+
+		case '@':
+			end := strings.IndexAny(src, ",;")
+			if end == -1 {
+				end = len(src)
+			}
+			name := strings.TrimSpace(src[1:end])
+			src = src[end:]
+			if name == "history" {
+				for _, e := range searchHistory.entries {
+					switch {
+					case e.Mode == SearchModeHex:
+						add(e.Pattern, describePattern(e.Mode, 0, e.Pattern))
+					case e.Mode == SearchModeText && e.Flags == 0:
+						add(e.Pattern, strconv.Quote(string(e.Pattern)))
+					}
+				}
+				continue
+			}
+			if !allowFiles {
+				return errors.New("nested pattern files are not supported")
+			}
+			if err := loadPatternFile(name, add); err != nil {
+				return err
+			}
+
+		default:
+			end := strings.IndexAny(src, ",;")
+			if end == -1 {
+				end = len(src)
+			}
+			item := strings.TrimSpace(src[:end])
+			if strings.Trim(item, HEX_CHARS+" ") != "" {
+				return fmt.Errorf("invalid hex pattern: %s (hint: quote text patterns)", item)
+			}
+			p := fromHex(item)
+			add(p, describePattern(SearchModeHex, 0, p))
+			src = src[end:]
+		}
+	}
+}
+
+// one pattern per line, '#' starts a comment line
+func loadPatternFile(fname string, add func([]byte, string)) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := parsePatternList(line, add, false); err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAhoMatcher(t *testing.T) {
+	m, err := newAhoMatcher(`"he", "she", "his", "hers"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte("ushers ahishe")
+	tests := []struct {
+		limit int // -1 for Index
+		want  int
+		match string
+	}{
+		{-1, 1, `"she"`},
+		{len(buf), 11, `"he"`},
+		{11, 10, `"she"`},
+		{10, 8, `"his"`},
+		{2, 1, `"she"`},
+		{1, -1, ""},
+	}
+	for _, tt := range tests {
+		var got, n int
+		if tt.limit == -1 {
+			got, n = m.Index(buf)
+		} else {
+			got, n = m.LastIndex(buf, tt.limit)
+		}
+		if got != tt.want {
+			t.Errorf("limit %d: %d, want %d", tt.limit, got, tt.want)
+			continue
+		}
+		if got != -1 {
+			if d := m.DescribeMatch(buf[got:]); d != tt.match || n != len(d)-2 {
+				t.Errorf("limit %d: %s %d, want %s", tt.limit, d, n, tt.match)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "4g", `"abc`, `""`} {
+		if _, err := newAhoMatcher(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestParseMultiPatterns(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // patterns joined with '|'
+	}{
+		{`4d5a`, "MZ"},
+		{`"PK\x03\x04"; 7f 45 4c 46`, "PK\x03\x04|\x7fELF"},
+		{"`raw\\n`, \"a\", \"a\"", `raw\n|a`},
+	}
+	for _, tt := range tests {
+		patterns, _, err := parseMultiPatterns(tt.src)
+		if err != nil {
+			t.Fatal(tt.src, err)
+		}
+		if got := string(bytes.Join(patterns, []byte("|"))); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.src, got, tt.want)
+		}
+	}
+	if _, _, err := parseMultiPatterns("hello"); err == nil || !strings.Contains(err.Error(), "quote text") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	BENCH_SIZE  = 256 * 1024 * 1024 // sparse file searched to the end
+	BENCH_BLOCK = 4 * 1024 * 1024   // data block written to the benchmark file
+	BENCH_GAP   = 16 * 1024 * 1024  // distance between the blocks, the rest is sparse
+)
+
+// sparse file with random data blocks and the pattern at the end, opened as the current document
+func openBenchFile(b *testing.B, pattern []byte) int64 {
+	f, err := os.Create(filepath.Join(b.TempDir(), "bench"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { f.Close() })
+	if err := f.Truncate(BENCH_SIZE); err != nil {
+		b.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	block := make([]byte, BENCH_BLOCK)
+	for pos := int64(0); pos < BENCH_SIZE; pos += BENCH_GAP {
+		rnd.Read(block)
+		if _, err := f.WriteAt(block, pos); err != nil {
+			b.Fatal(err)
+		}
+	}
+	hit := int64(BENCH_SIZE - len(pattern) - 1)
+	if _, err := f.WriteAt(pattern, hit); err != nil {
+		b.Fatal(err)
+	}
+
+	fname, fileSize = f.Name(), BENCH_SIZE
+	doc = NewDocument(f, fileSize)
+	reader = doc
+	sparseMap = make([]Range, 0)
+	buildSparseMap()
+	return hit
+}
+
+// serial vs parallel forward search
+func BenchmarkSearch(b *testing.B) {
+	pattern := []byte("needle in a haystack")
+	hit := openBenchFile(b, pattern)
+
+	patterns := []struct {
+		mode    int
+		pattern string
+	}{
+		{SearchModeHex, string(pattern)},
+		{SearchModeText, string(pattern)},
+		{SearchModeRegex, "needle\\s+in"},
+		{SearchModeRegex, "needle [^\\x00]n"},
+		{SearchModeHexMask, "6e 65 65 ?? 6c 65"},
+		{SearchModeMulti, `"haystack", "needle", 00 11 22 33`},
+	}
+	workers := []int64{1}
+	if n := numSearchWorkers(); n > 1 {
+		workers = append(workers, int64(n))
+	}
+	defer func(n int64) { searchWorkers = n }(searchWorkers)
+	for _, p := range patterns {
+		m, err := newMatcher(p.mode, 0, []byte(p.pattern))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, n := range workers {
+			searchWorkers = n
+			b.Run(fmt.Sprintf("%s/workers=%d", describePattern(p.mode, 0, []byte(p.pattern)), n), func(b *testing.B) {
+				b.SetBytes(BENCH_SIZE)
+				for i := 0; i < b.N; i++ {
+					found := int64(-1)
+					err := scanForward(m, 0, fileSize,
+						func(pos int64) bool { return true },
+						func(pos int64) bool {
+							found = pos
+							return false
+						})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if found != hit {
+						b.Fatalf("found %X, want %X", found, hit)
+					}
+				}
+			})
+		}
+	}
+}
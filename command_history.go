@@ -40,7 +40,7 @@ func (sh *CommandHistory) Add(command string) {
 	}
 	sh.entries = append(sh.entries, CommandHistoryEntry{Command: command, Ts: time.Now().UnixNano()})
 	sh.pos = len(sh.entries) // set position to last entry+1 (new entry)
-	go sh.Save()
+	go func() { postError("command history: ", sh.Save()) }()
 }
 
 func (sh *CommandHistory) Prev() string {
@@ -67,16 +67,15 @@ func (sh *CommandHistory) fileName() string {
 	return filepath.Join(path, "command_history.json")
 }
 
-func (sh *CommandHistory) Save() {
+func (sh *CommandHistory) Save() error {
 	fname := sh.fileName()
 	if fname == "" {
-		return
+		return nil
 	}
 
 	err := os.MkdirAll(filepath.Dir(fname), 0700)
 	if err != nil {
-		lastErrMsg = "[?] " + err.Error()
-		return
+		return err
 	}
 
 	merged := sh
@@ -84,7 +83,9 @@ func (sh *CommandHistory) Save() {
 	fi, err := os.Stat(fname)
 	if err == nil && (fi.ModTime() != sh.fileTimestamp || fi.Size() != sh.fileSize) {
 		merged = &CommandHistory{}
-		merged.Load()
+		if err := merged.Load(); err != nil {
+			return err
+		}
 		merged.entries = append(merged.entries, sh.entries...)
 		merged.sort_uniq()
 	}
@@ -97,12 +98,11 @@ func (sh *CommandHistory) Save() {
 
 	f, err := os.Create(fname)
 	if err != nil {
-		lastErrMsg = "[?] " + err.Error()
+		return err
 	}
 	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.Encode(entries)
+	return json.NewEncoder(f).Encode(entries)
 }
 
 func (sh *CommandHistory) sort_uniq() {
@@ -119,24 +119,26 @@ func (sh *CommandHistory) sort_uniq() {
 	}
 }
 
-func initCommandHistory() {
-	commandHistory.Load()
+// runs in the background, the error is shown by the caller
+func initCommandHistory() error {
+	return commandHistory.Load()
 }
 
-func (sh *CommandHistory) Load() {
-	sh.tryLoad()
+func (sh *CommandHistory) Load() error {
+	err := sh.tryLoad()
 	sh.pos = len(sh.entries)
 	sh.ready = true
+	return err
 }
 
-func (sh *CommandHistory) tryLoad() {
+func (sh *CommandHistory) tryLoad() error {
 	fname := sh.fileName()
 	if fname == "" {
-		return
+		return nil
 	}
 	fi, err := os.Stat(fname)
 	if err != nil {
-		return
+		return nil
 	}
 
 	sh.fileTimestamp = fi.ModTime()
@@ -144,12 +146,10 @@ func (sh *CommandHistory) tryLoad() {
 
 	f, err := os.Open(fname)
 	if err != nil {
-		return
+		return nil
 	}
 	defer f.Close()
 
 	dec := json.NewDecoder(f)
-	if err := dec.Decode(&sh.entries); err != nil {
-		lastErrMsg = "[?] " + err.Error()
-	}
+	return dec.Decode(&sh.entries)
 }
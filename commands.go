@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -11,42 +12,63 @@ var INT_VARS = []struct {
 	pvar         interface{}
 	type_id      reflect.Type
 	defaultRadix int
+	help         string
 }{
-	{"cols", &cols, reflect.TypeOf(cols), 10},
-	{"base", &base, reflect.TypeOf(base), 16},
-	{"baseMult", &baseMult, reflect.TypeOf(baseMult), 16},
-	{"pageSize", &pageSize, reflect.TypeOf(pageSize), 10},
-	{"allowWrite", &allowWrite, reflect.TypeOf(allowWrite), 0},
+	{"cols", &cols, reflect.TypeOf(cols), 10, "number of columns"},
+	{"base", &base, reflect.TypeOf(base), 16, "address of the file start"},
+	{"baseMult", &baseMult, reflect.TypeOf(baseMult), 16, "address = base + offset*baseMult"},
+	{"pageSize", &pageSize, reflect.TypeOf(pageSize), 10, "pgup/pgdn step, 0 = screen"},
+	{"allowWrite", &allowWrite, reflect.TypeOf(allowWrite), 0, "allow writing to the file"},
+	{"persistUndo", &persistUndo, reflect.TypeOf(persistUndo), 0, "keep the journal of file writes"},
+	{"searchWorkers", &searchWorkers, reflect.TypeOf(searchWorkers), 10, "parallel search workers, 0 = number of CPUs"},
+	{"dedup", &g_dedup, reflect.TypeOf(g_dedup), 0, "hide duplicate lines"},
+	{"binary", &showBin, reflect.TypeOf(showBin), 0, "show binary"},
+	{"hex", &showHex, reflect.TypeOf(showHex), 0, "show hex"},
+	{"ascii", &showASCII, reflect.TypeOf(showASCII), 0, "show ASCII"},
 }
 
-var COMMANDS = []struct {
-	name string
-	fn   func(string)
-}{
-	{"beep", func(string) { beep() }},
-	{"goto", cmd_goto},
-	{"print", cmd_print},
-	{"set", cmd_set},
+type Command struct {
+	name  string
+	fn    func(string)
+	usage string // arguments
+	help  string
+}
+
+var COMMANDS = []Command{
+	{"addrmap", cmd_addrmap, "[auto | <file> | off]", "address map from the executable's segments or a file, lists it without arguments"},
+	{"beep", func(string) { beep() }, "", "beep"},
+	{"bookmark", cmd_bookmark, "<0-9> [expr]", "set a bookmark at the cursor or address"},
+	{"copy", cmd_copy, "<src> <dst> <len>", "copy bytes in the file, overlapping ranges are fine"},
+	{"delete", cmd_delete, "[size]", "delete bytes at the cursor, or the selection"},
+	{"fill", cmd_fill, "<start> <len> <pattern>", "fill the file with hex \"text\" or seq(start[, step[, width]]) pattern"},
+	{"hash", cmd_hash, "[algo,...|all] [<start> <len>] | find <crc> [algo] [<start> <len>]", "checksums of the selection or the file, or find the range giving a crc (up to 16MiB, starting in up to 4MiB, linear time)"},
+	{"findall", func(string) { findAll() }, "", "find all matches of the last search"},
+	{"goto", cmd_goto, "<expr>", "go to an address"},
+	{"insert", cmd_insert, "<size> [hex pattern]", "insert bytes at the cursor"},
+	{"let", cmd_let, "<name> = <expr>", "define a variable"},
+	{"macro", cmd_macro, "[<register> [count]]", "play a macro, lists them without arguments"},
+	{"move", cmd_move, "<src> <dst> <len>", "copy bytes in the file, zero the rest of the source"},
+	{"print", cmd_print, "<expr>", "show the value of an expression"},
+	{"redo", func(string) { redo() }, "", "redo"},
+	{"save", func(string) { saveEdits() }, "", "save changes"},
+	{"saveas", cmd_saveas, "<file>", "save to a new file"},
+	{"select", cmd_select, "[<start> <len>]", "select a range, clears the selection without arguments"},
+	{"set", cmd_set, "[<name>=<value> ...]", "set variables, lists them without arguments"},
+	{"stats", cmd_stats, "[<start> <len>]", "byte histogram and entropy of the selection or the file"},
+	{"symbols", func(args string) { showSymbols(strings.TrimSpace(args)) }, "[filter]", "list of symbols"},
+	{"undo", func(string) { undo() }, "", "undo"},
+	{"write", cmd_write, "<file>", "write the selection to a file"},
+	{"zero", cmd_zero, "[<start> <len>]", "zero bytes in the file, the selection without arguments"},
 }
 
 func cmd_print(args string) {
+	// the whole argument is an expression, it may contain spaces
+	args = strings.TrimSpace(args)
 	if args == "" {
 		showErrStr("print: need one argument")
 		return
 	}
 
-	a := strings.Split(args, " ")
-	if len(a) != 1 {
-		showErrStr("print: need one argument, got ", len(a))
-		return
-	}
-
-	args = strings.TrimSpace(a[0])
-	if args == "" {
-		showErrStr("print: empty argument")
-		return
-	}
-
 	res, err := parseExprRadix(args, 16)
 	if err != nil {
 		showError(err)
@@ -56,38 +78,118 @@ func cmd_print(args string) {
 }
 
 func cmd_goto(args string) {
+	// the whole argument is an expression, it may contain spaces
+	args = strings.TrimSpace(args)
 	if args == "" {
 		showErrStr("goto: need one argument")
 		return
 	}
 
-	a := strings.Split(args, " ")
-	if len(a) != 1 {
-		showErrStr("goto: need one argument, got ", len(a))
+	offs, err := parseExprRadix(args, 16)
+	if err != nil {
+		showError(err)
 		return
 	}
+	gotoOffset(offs)
+}
 
-	args = strings.TrimSpace(a[0])
-	if args == "" {
-		showErrStr("goto: empty argument")
+// bookmark <0-9> [expr], at the cursor if no expression is given
+func cmd_bookmark(args string) {
+	a := strings.SplitN(strings.TrimSpace(args), " ", 2)
+	if len(a[0]) != 1 || a[0][0] < '0' || a[0][0] > '9' {
+		showErrStr("bookmark: need number 0-9")
 		return
 	}
+	pos := cursor
+	if len(a) > 1 {
+		ea, err := parseExprRadix(a[1], 16)
+		if err != nil {
+			showError(err)
+			return
+		}
+		if pos = ea2offset(ea); pos < 0 || pos >= fileSize {
+			showErrStr("bookmark: out of range: ", a[1])
+			return
+		}
+	}
+	bookmarks[a[0][0]-'0'] = pos
+}
 
-	offs, err := parseExprRadix(args, 16)
+// insert <size> [hex pattern]
+func cmd_insert(args string) {
+	a := strings.SplitN(strings.TrimSpace(args), " ", 2)
+	if a[0] == "" {
+		showErrStr("insert: need size")
+		return
+	}
+	size, err := parseExprRadix(a[0], 16)
 	if err != nil {
 		showError(err)
 		return
 	}
-	gotoOffset(offs)
+	if size <= 0 {
+		showErrStr("insert: invalid size")
+		return
+	}
+	pattern := []byte{0}
+	if len(a) > 1 {
+		pattern = fromHex(a[1])
+		if len(pattern) == 0 {
+			pattern = []byte{0}
+		}
+	}
+	modifyDoc(false, func() { doc.InsertRepeated(cursor, size, pattern) })
+}
+
+// delete [size], deletes the selection if no size is given
+func cmd_delete(args string) {
+	pos, size := selectionOr(0)
+	if args != "" {
+		var err error
+		if size, err = parseExprRadix(strings.TrimSpace(args), 16); err != nil {
+			showError(err)
+			return
+		}
+		pos = cursor
+	} else if size == 0 {
+		showErrStr("delete: need size")
+		return
+	}
+	if size <= 0 || pos+size > fileSize {
+		showErrStr("delete: invalid size")
+		return
+	}
+	modifyDoc(false, func() { doc.Delete(pos, size) })
+	if args == "" {
+		clearSelection()
+	}
+	cursor = pos
+}
+
+func cmd_saveas(args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		showErrStr("saveas: need file name")
+		return
+	}
+	saveAs(args)
 }
 
 func cmd_set(args string) {
+	args = strings.TrimSpace(args)
 	if args == "" {
-		// TODO: show current vars
+		showVars()
 		return
 	}
 
-	a := strings.Split(args, " ")
+	// "name=1 name2=2", or a single "name = expr" with spaces
+	a := strings.Fields(args)
+	for _, v := range a {
+		if !strings.Contains(v, "=") {
+			a = []string{args}
+			break
+		}
+	}
 	for _, v := range a {
 		args := strings.SplitN(v, "=", 2)
 		if len(args) < 2 {
@@ -101,33 +203,57 @@ func cmd_set(args string) {
 	}
 }
 
-func run_cmd(cmd string) {
-	a := strings.SplitN(cmd, " ", 2)
-	cmd = a[0]
-
-	args := ""
-	if len(a) > 1 {
-		args = a[1]
-	}
-
-	names := make([]string, 0)
-	var pfun func(string)
+// for commands referring to run_cmd, i.e. through the key actions, to avoid an initialization cycle
+func addCommand(name string, fn func(string), usage, help string) {
+	COMMANDS = append(COMMANDS, Command{name, fn, usage, help})
+	sort.Slice(COMMANDS, func(i, j int) bool { return COMMANDS[i].name < COMMANDS[j].name })
+}
 
+// names of the commands starting with prefix, exact match wins, i.e. "save" vs "saveas"
+func matchCommands(prefix string) (names []string, exact bool) {
+	names = make([]string, 0)
 	for _, c := range COMMANDS {
-		if strings.HasPrefix(c.name, cmd) {
+		if c.name == prefix {
+			return []string{c.name}, true
+		}
+		if strings.HasPrefix(c.name, prefix) {
 			names = append(names, c.name)
-			pfun = c.fn
 		}
 	}
+	return names, false
+}
 
+// command by its name or unique prefix
+func findCommand(cmd string) (func(string), error) {
+	names, _ := matchCommands(cmd)
 	switch len(names) {
 	case 0:
-		showErrStr("unknown command: " + cmd)
+		return nil, fmt.Errorf("unknown command: %s", cmd)
 	case 1:
-		pfun(args)
-	default:
-		showErrStr("ambiguous command: "+cmd+" (", strings.Join(names, ", "), ")")
+		for _, c := range COMMANDS {
+			if c.name == names[0] {
+				return c.fn, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("ambiguous command: %s (%s)", cmd, strings.Join(names, ", "))
+}
+
+func run_cmd(cmd string) {
+	a := strings.SplitN(cmd, " ", 2)
+	cmd = a[0]
+
+	args := ""
+	if len(a) > 1 {
+		args = a[1]
+	}
+
+	pfun, err := findCommand(cmd)
+	if err != nil {
+		showError(err)
+		return
 	}
+	pfun(args)
 }
 
 func try_set_var(name, expr string) bool {
@@ -158,6 +284,6 @@ func try_set_var(name, expr string) bool {
 			return true
 		}
 	}
-	showErrStr("unknown variable: " + name)
+	showErrStr("set: unknown variable: ", name, " (:let defines new ones)")
 	return false
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// commands taking a file name
+var FILE_ARG_COMMANDS = []string{"addrmap", "saveas", "source", "write"}
+
+// chars of names in expressions, variables are case-insensitive there
+func isNameChar(c byte) bool {
+	return isWordChar(c) || c >= 'A' && c <= 'Z' || c == '@'
+}
+
+// candidates for the word ending at pos in a command line, and the start of the word
+func completeCommand(line string, pos int) (int, []string) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 || pos <= i {
+		names := make([]string, 0)
+		for _, c := range COMMANDS {
+			if strings.HasPrefix(c.name, line[:pos]) {
+				names = append(names, c.name)
+			}
+		}
+		return 0, names
+	}
+
+	cmd := line[:i]
+	if names, exact := matchCommands(cmd); len(names) == 1 || exact {
+		cmd = names[0]
+	}
+	args := line[i+1 : pos]
+	switch {
+	case cmd == "help":
+		start, names := completeCommand(args, len(args))
+		return i + 1 + start, names
+	case cmd == "map":
+		// the action after the key
+		a := strings.SplitN(strings.TrimLeft(args, " "), " ", 2)
+		if len(a) < 2 {
+			return pos, nil
+		}
+		names := make([]string, 0)
+		for _, action := range ACTIONS {
+			if strings.HasPrefix(action.name, a[1]) {
+				names = append(names, action.name)
+			}
+		}
+		return pos - len(a[1]), names
+	case isFileArgCommand(cmd):
+		word := strings.TrimLeft(args, " ")
+		names := completeFile(word)
+		if cmd == "addrmap" {
+			for _, s := range []string{"auto", "off"} {
+				if strings.HasPrefix(s, word) {
+					names = append(names, s)
+				}
+			}
+		}
+		return pos - len(word), names
+	}
+
+	// names in expressions
+	start := pos
+	for start > i+1 && isNameChar(line[start-1]) {
+		start--
+	}
+	return start, completeName(line[start:pos])
+}
+
+func isFileArgCommand(cmd string) bool {
+	for _, c := range FILE_ARG_COMMANDS {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// directories end with a separator, dot files are shown only for a word starting with a dot
+func completeFile(word string) []string {
+	dir, base := filepath.Split(word)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if e.IsDir() {
+			name += string(filepath.Separator)
+		}
+		names = append(names, dir+name)
+	}
+	return names
+}
+
+// variables, symbols and functions starting with word, case-insensitive
+func completeName(word string) []string {
+	all := make([]string, 0)
+	for _, v := range INT_VARS {
+		all = append(all, v.name)
+	}
+	for name := range userVars {
+		all = append(all, name)
+	}
+	all = append(all, "fileSize", "selStart", "selEnd", FILE_FUNC+"(", SYM_FUNC+"(")
+	for name := range DEREF_FUNCS {
+		all = append(all, name+"(")
+	}
+	for _, s := range symbols {
+		all = append(all, s.Name)
+	}
+
+	word = strings.ToLower(word)
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range all {
+		if strings.HasPrefix(strings.ToLower(name), word) && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// longest common prefix, case-insensitive
+func commonPrefix(names []string) string {
+	prefix := names[0]
+	for _, name := range names[1:] {
+		n := 0
+		for n < len(prefix) && n < len(name) && strings.EqualFold(prefix[n:n+1], name[n:n+1]) {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+// completes the word ending at pos: a single candidate or the common prefix is inserted, more of them are listed to choose
+func completeLine(line string, pos int) string {
+	start, names := completeCommand(line, pos)
+	word := line[start:pos]
+	choice := ""
+	switch {
+	case len(names) == 0:
+		beep()
+		return line
+	case len(names) == 1:
+		choice = names[0]
+	case len(commonPrefix(names)) > len(word):
+		return line[:start] + commonPrefix(names) + line[pos:]
+	default:
+		panel := &ListPanel{
+			Title: "completions: " + word,
+			Len:   func() int { return len(names) },
+			Line:  func(i int) string { return names[i] },
+			Keys:  "enter: choose  esc: close",
+		}
+		i := panel.Run(func(*tcell.EventKey, int) bool { return false })
+		draw()
+		if i < 0 {
+			return line
+		}
+		choice = names[i]
+	}
+
+	// command name, ready for the arguments
+	if start == 0 && pos == len(line) {
+		choice += " "
+	}
+	return line[:start] + choice + line[pos:]
+}
@@ -62,3 +62,11 @@ func buildSparseMap() {
 	}
 	mapReady = true
 }
+
+// device and inode numbers, used to tell apart files with the same path
+func fileIdentity(fi os.FileInfo) (uint64, uint64) {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Dev), uint64(stat.Ino)
+	}
+	return 0, 0
+}
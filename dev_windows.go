@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"golang.org/x/sys/windows"
+	"os"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -122,3 +123,8 @@ func buildSparseMap() {
 
 	mapReady = true
 }
+
+// os.FileInfo on windows carries no device/file ids, rely on path+size+mtime
+func fileIdentity(fi os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
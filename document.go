@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// Piece is a part of the document: either a range of the original file or a range of the add buffer
+type Piece struct {
+	orig   bool
+	start  int64 // offset in the original file or in the add buffer
+	size   int64
+	period int64 // > 0 if the piece repeats period bytes of the add buffer from start, i.e. a big insertion
+	phase  int64 // index in the repeated bytes of the first byte
+}
+
+// Document is a piece table on top of the original file.
+// Overwrites, insertions and deletions are kept in memory, the file is only read.
+// Pieces slices are never modified in place, so they can be kept as undo snapshots.
+type Document struct {
+	Reader
+	origSize int64
+	pieces   []Piece
+	starts   []int64 // document offset of each piece
+	size     int64
+	add      []byte // append-only
+	pos      int64  // for Read/Seek
+}
+
+var doc = NewDocument(nil, 0)
+
+var errNotIdentity = errors.New("there are pending insertions/deletions (hint: use :saveas)")
+
+func NewDocument(r Reader, size int64) *Document {
+	d := &Document{Reader: r, origSize: size}
+	d.Restore(d.Original())
+	return d
+}
+
+// pieces of the unmodified file
+func (d *Document) Original() []Piece {
+	if d.origSize == 0 {
+		return []Piece{}
+	}
+	return []Piece{{orig: true, size: d.origSize}}
+}
+
+func (d *Document) Snapshot() []Piece {
+	return d.pieces
+}
+
+func (d *Document) Restore(pieces []Piece) {
+	d.pieces = pieces
+	d.starts = make([]int64, len(pieces))
+	d.size = 0
+	for i, p := range pieces {
+		d.starts[i] = d.size
+		d.size += p.size
+	}
+}
+
+func (d *Document) Size() int64 {
+	return d.size
+}
+
+// index of the piece containing pos, or len(pieces)
+func (d *Document) find(pos int64) int {
+	return sort.Search(len(d.starts), func(i int) bool {
+		return d.starts[i]+d.pieces[i].size > pos
+	})
+}
+
+func (d *Document) ReadAt(buf []byte, pos int64) (int, error) {
+	if pos >= d.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for i := d.find(pos); n < len(buf) && i < len(d.pieces); i++ {
+		p := d.pieces[i]
+		inPiece := pos + int64(n) - d.starts[i]
+		cnt := int(min64(int64(len(buf)-n), p.size-inPiece))
+		if p.orig {
+			m, err := d.Reader.ReadAt(buf[n:n+cnt], p.start+inPiece)
+			n += m
+			if m < cnt {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return n, err
+			}
+		} else if p.period > 0 {
+			for k := int64(0); k < int64(cnt); k++ {
+				buf[n] = d.add[p.start+(p.phase+inPiece+k)%p.period]
+				n++
+			}
+		} else {
+			n += copy(buf[n:n+cnt], d.add[p.start+inPiece:])
+		}
+	}
+
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (d *Document) Read(buf []byte) (int, error) {
+	n, err := d.ReadAt(buf, d.pos)
+	d.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil // like os.File, report EOF on the next read
+	}
+	return n, err
+}
+
+func (d *Document) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: negative position")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+// returns pieces with a boundary at pos, and the index of the piece starting at pos
+func (d *Document) split(pieces []Piece, pos int64) ([]Piece, int) {
+	var start int64
+	for i, p := range pieces {
+		if pos == start {
+			return pieces, i
+		}
+		if pos < start+p.size {
+			left, right := p, p
+			left.size = pos - start
+			right.size = p.size - left.size
+			if p.period > 0 {
+				right.phase = (p.phase + left.size) % p.period
+			} else {
+				right.start += left.size
+			}
+			res := make([]Piece, 0, len(pieces)+1)
+			res = append(res, pieces[:i]...)
+			res = append(res, left, right)
+			res = append(res, pieces[i+1:]...)
+			return res, i + 1
+		}
+		start += p.size
+	}
+	return pieces, len(pieces)
+}
+
+// replaces size bytes at pos with data
+func (d *Document) replace(pos, size int64, data []byte) {
+	pieces, i := d.split(d.pieces, pos)
+	pieces, j := d.split(pieces, pos+size)
+
+	res := make([]Piece, 0, len(pieces)+1)
+	res = append(res, pieces[:i]...)
+	if len(data) > 0 {
+		p := Piece{start: int64(len(d.add)), size: int64(len(data))}
+		d.add = append(d.add, data...)
+		// merge with the previous piece if it's adjacent in the add buffer, i.e. when typing
+		if i > 0 && !res[i-1].orig && res[i-1].period == 0 && res[i-1].start+res[i-1].size == p.start {
+			res[i-1].size += p.size
+		} else {
+			res = append(res, p)
+		}
+	}
+	res = append(res, pieces[j:]...)
+	d.Restore(res)
+}
+
+func (d *Document) Overwrite(pos int64, data []byte) {
+	d.replace(pos, min64(int64(len(data)), d.size-pos), data)
+}
+
+func (d *Document) Insert(pos int64, data []byte) {
+	d.replace(pos, 0, data)
+}
+
+// inserts size bytes repeating the pattern, without allocating them
+func (d *Document) InsertRepeated(pos, size int64, pattern []byte) {
+	pieces, i := d.split(d.pieces, pos)
+	res := make([]Piece, 0, len(pieces)+1)
+	res = append(res, pieces[:i]...)
+	res = append(res, Piece{start: int64(len(d.add)), size: size, period: int64(len(pattern))})
+	res = append(res, pieces[i:]...)
+	d.add = append(d.add, pattern...)
+	d.Restore(res)
+}
+
+func (d *Document) Delete(pos, size int64) {
+	d.replace(pos, min64(size, d.size-pos), nil)
+}
+
+// puts back the original file data of the range, only valid if IsIdentity()
+func (d *Document) Revert(pos, size int64) {
+	pieces, i := d.split(d.pieces, pos)
+	pieces, j := d.split(pieces, pos+size)
+
+	res := make([]Piece, 0, len(pieces)+1)
+	res = append(res, pieces[:i]...)
+	res = append(res, Piece{orig: true, start: pos, size: size})
+	res = append(res, pieces[j:]...)
+
+	// join adjacent original pieces
+	merged := make([]Piece, 0, len(res))
+	for _, p := range res {
+		if n := len(merged); n > 0 && p.orig && merged[n-1].orig && merged[n-1].start+merged[n-1].size == p.start {
+			merged[n-1].size += p.size
+		} else {
+			merged = append(merged, p)
+		}
+	}
+	d.Restore(merged)
+}
+
+// is the byte at pos changed, inserted or moved?
+func (d *Document) IsModified(pos int64) bool {
+	i := d.find(pos)
+	if i >= len(d.pieces) {
+		return false
+	}
+	return !d.pieces[i].orig
+}
+
+func (d *Document) Modified() bool {
+	orig := d.Original()
+	return len(d.pieces) != len(orig) || len(orig) > 0 && d.pieces[0] != orig[0]
+}
+
+// true if every byte is at the same offset as in the original file, i.e. there are no insertions/deletions
+func (d *Document) IsIdentity() bool {
+	if d.size != d.origSize {
+		return false
+	}
+	for i, p := range d.pieces {
+		if p.orig && p.start != d.starts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// maps document position to the original file offset (-1 if the byte is not from the file),
+// also returns the document range of the piece containing pos
+func (d *Document) origOffset(pos int64) (int64, int64, int64) {
+	i := d.find(pos)
+	if i >= len(d.pieces) {
+		return -1, d.size, d.size
+	}
+	p := d.pieces[i]
+	if !p.orig {
+		return -1, d.starts[i], d.starts[i] + p.size
+	}
+	return p.start + pos - d.starts[i], d.starts[i], d.starts[i] + p.size
+}
+
+// changed ranges along with the original data, only valid if IsIdentity()
+func (d *Document) Chunks() ([]UndoChunk, error) {
+	chunks := make([]UndoChunk, 0)
+	for i := 0; i < len(d.pieces); i++ {
+		if d.pieces[i].orig {
+			continue
+		}
+		start := d.starts[i]
+		size := d.pieces[i].size
+		for i+1 < len(d.pieces) && !d.pieces[i+1].orig {
+			i++
+			size += d.pieces[i].size
+		}
+		data := make([]byte, size)
+		if _, err := d.ReadAt(data, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		old, err := readOriginal(start, size)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, UndoChunk{start, old, data})
+	}
+	return chunks, nil
+}
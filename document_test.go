@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func readDoc(t *testing.T, d *Document) []byte {
+	buf := make([]byte, d.Size()+4)
+	n, err := d.ReadAt(buf, 0)
+	if int64(n) != d.Size() || err != nil && err != io.EOF {
+		t.Fatalf("read %d of %d: %v", n, d.Size(), err)
+	}
+	return buf[:n]
+}
+
+// document edit, and the same edit of a plain slice
+type docEdit struct {
+	op      string // "overwrite", "insert", "repeat", "delete"
+	pos     int64
+	size    int64 // delete, repeat
+	data    string
+	pattern string // repeat
+}
+
+func (e docEdit) apply(d *Document, model []byte) []byte {
+	switch e.op {
+	case "overwrite":
+		d.Overwrite(e.pos, []byte(e.data))
+		end := min64(e.pos+int64(len(e.data)), int64(len(model)))
+		model = append(model[:e.pos], append([]byte(e.data), model[end:]...)...)
+	case "insert":
+		d.Insert(e.pos, []byte(e.data))
+		model = append(model[:e.pos], append([]byte(e.data), model[e.pos:]...)...)
+	case "repeat":
+		d.InsertRepeated(e.pos, e.size, []byte(e.pattern))
+		data := bytes.Repeat([]byte(e.pattern), int(e.size)/len(e.pattern)+1)[:e.size]
+		model = append(model[:e.pos], append(data, model[e.pos:]...)...)
+	case "delete":
+		d.Delete(e.pos, e.size)
+		end := min64(e.pos+e.size, int64(len(model)))
+		model = append(model[:e.pos], model[end:]...)
+	}
+	return model
+}
+
+func TestDocumentEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []docEdit
+		want  string
+	}{
+		{"none", nil, "0123456789"},
+		{"overwrite", []docEdit{{op: "overwrite", pos: 2, data: "ab"}}, "01ab456789"},
+		{"overwrite past the end extends", []docEdit{{op: "overwrite", pos: 8, data: "abcd"}}, "01234567abcd"},
+		{"insert", []docEdit{{op: "insert", pos: 3, data: "xy"}}, "012xy3456789"},
+		{"insert at the start", []docEdit{{op: "insert", pos: 0, data: "x"}}, "x0123456789"},
+		{"insert at the end", []docEdit{{op: "insert", pos: 10, data: "x"}}, "0123456789x"},
+		{"typing", []docEdit{{op: "insert", pos: 1, data: "a"}, {op: "insert", pos: 2, data: "b"}, {op: "insert", pos: 3, data: "c"}}, "0abc123456789"},
+		{"delete", []docEdit{{op: "delete", pos: 2, size: 3}}, "0156789"},
+		{"delete past the end", []docEdit{{op: "delete", pos: 8, size: 5}}, "01234567"},
+		{"delete an insertion", []docEdit{{op: "insert", pos: 5, data: "abc"}, {op: "delete", pos: 4, size: 5}}, "01236789"},
+		{"overwrite across pieces", []docEdit{{op: "insert", pos: 5, data: "abc"}, {op: "overwrite", pos: 4, data: "XYZW"}}, "0123XYZW56789"},
+		{"repeat", []docEdit{{op: "repeat", pos: 2, size: 7, pattern: "abc"}}, "01abcabca23456789"},
+		{"repeat split", []docEdit{{op: "repeat", pos: 2, size: 7, pattern: "abc"}, {op: "insert", pos: 4, data: "-"}}, "01ab-cabca23456789"},
+		{"repeat delete in the middle", []docEdit{{op: "repeat", pos: 0, size: 6, pattern: "ab"}, {op: "delete", pos: 1, size: 2}}, "abab0123456789"},
+		{"repeat overwrite", []docEdit{{op: "repeat", pos: 10, size: 5, pattern: "xy"}, {op: "overwrite", pos: 11, data: "Z"}}, "0123456789xZxyx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestFile(t, []byte("0123456789"))
+			model := []byte("0123456789")
+			for _, e := range tt.edits {
+				model = e.apply(doc, model)
+			}
+			if got := readDoc(t, doc); string(got) != tt.want || string(model) != tt.want {
+				t.Fatalf("got %q, model %q, want %q", got, model, tt.want)
+			}
+			if doc.Modified() != (len(tt.edits) > 0) {
+				t.Fatal("modified:", doc.Modified())
+			}
+		})
+	}
+}
+
+// random edits against a plain slice, reads at random positions
+func TestDocumentRandom(t *testing.T) {
+	orig := make([]byte, 1000)
+	for i := range orig {
+		orig[i] = byte(i)
+	}
+	openTestFile(t, orig)
+	model := append([]byte{}, orig...)
+	rnd := rand.New(rand.NewSource(1))
+	var snapshot []Piece
+	var snapshotModel []byte
+	for i := 0; i < 2000; i++ {
+		pos := rnd.Int63n(int64(len(model)) + 1)
+		e := docEdit{pos: pos, size: rnd.Int63n(50) + 1, data: string([]byte{byte(i), byte(i >> 8)}), pattern: "pqr"[:rnd.Intn(3)+1]}
+		switch rnd.Intn(4) {
+		case 0:
+			e.op = "overwrite"
+		case 1:
+			e.op = "insert"
+		case 2:
+			e.op = "repeat"
+		default:
+			e.op = "delete"
+		}
+		if pos == int64(len(model)) && e.op == "overwrite" {
+			continue
+		}
+		model = e.apply(doc, model)
+		if i == 1000 {
+			snapshot, snapshotModel = doc.Snapshot(), append([]byte{}, model...)
+		}
+
+		if doc.Size() != int64(len(model)) {
+			t.Fatalf("%d %+v: size %d, want %d", i, e, doc.Size(), len(model))
+		}
+		start := rnd.Int63n(int64(len(model)) + 1)
+		buf := make([]byte, rnd.Intn(100))
+		n, _ := doc.ReadAt(buf, start)
+		want := model[start:min64(start+int64(len(buf)), int64(len(model)))]
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatalf("%d %+v: read at %d: %x, want %x", i, e, start, buf[:n], want)
+		}
+	}
+	if !bytes.Equal(readDoc(t, doc), model) {
+		t.Fatal("content differs")
+	}
+	doc.Restore(snapshot)
+	if !bytes.Equal(readDoc(t, doc), snapshotModel) {
+		t.Fatal("snapshot differs")
+	}
+	doc.Restore(doc.Original())
+	if !bytes.Equal(readDoc(t, doc), orig) || doc.Modified() {
+		t.Fatal("original differs")
+	}
+}
+
+// the insertion is not allocated, reads anywhere in it see the pattern
+func TestDocumentBigRepeat(t *testing.T) {
+	openTestFile(t, []byte("0123456789"))
+	const size = 1 << 40
+	doc.InsertRepeated(2, size, []byte{0xaa, 0xbb, 0xcc})
+	tests := []struct {
+		pos  int64
+		want string
+	}{
+		{0, "01\xaa\xbb"},
+		{size - 2, "\xaa\xbb\xcc\xaa2345"},
+		{size / 2, "\xaa\xbb\xcc\xaa"},
+		{size + 2, "23456789"},
+	}
+	for _, tt := range tests {
+		buf := make([]byte, len(tt.want))
+		if n, _ := doc.ReadAt(buf, tt.pos); string(buf[:n]) != tt.want {
+			t.Errorf("at %X: %x, want %x", tt.pos, buf[:n], tt.want)
+		}
+	}
+	if doc.Size() != size+10 || doc.IsIdentity() {
+		t.Fatal(doc.Size(), doc.IsIdentity())
+	}
+}
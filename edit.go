@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	EditColHex = iota
+	EditColASCII
+)
+
+const ERR_WRITE_NOT_ALLOWED = "Writing is not allowed (hint: use -w option or ':set allowWrite=1')"
+
+var (
+	editMode   bool = false
+	editInsert bool = false // insert new bytes instead of overwriting
+	editColumn      = EditColHex
+	editNibble int  = 0 // 0 = high, 1 = low nibble of the byte under cursor
+)
+
+func enterEditMode() {
+	if fileSize == 0 {
+		editInsert = true
+	}
+	editMode = true
+	editNibble = 0
+	undoJournal.merge = false
+}
+
+// handles a key in edit mode, returns false if the key should be processed as usual
+func handleEditKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEsc:
+		editMode = false
+		return true
+	case tcell.KeyInsert:
+		editInsert = !editInsert
+		editNibble = 0
+		undoJournal.merge = false
+		return true
+	case tcell.KeyDelete:
+		if cursor < fileSize {
+			modifyDoc(false, func() { doc.Delete(cursor, 1) })
+		} else {
+			beep()
+		}
+		editNibble = 0
+		return true
+	case tcell.KeyTab:
+		editColumn = 1 - editColumn
+		editNibble = 0
+		return true
+	case tcell.KeyCtrlS:
+		saveEdits()
+		return true
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if editInsert && cursor > 0 {
+			cursor--
+			modifyDoc(false, func() { doc.Delete(cursor, 1) })
+		} else if editNibble == 0 {
+			cursor--
+		}
+		editNibble = 0
+		undoJournal.merge = false
+		return true
+	case tcell.KeyRune:
+		if ev.Modifiers()&tcell.ModAlt != 0 {
+			return false
+		}
+		if editColumn == EditColHex {
+			editHexDigit(ev.Rune())
+		} else {
+			editChar(ev.Rune())
+		}
+		return true
+	}
+
+	// navigation keys reset the nibble position and start a new undo step
+	editNibble = 0
+	undoJournal.merge = false
+	return false
+}
+
+func editHexDigit(r rune) {
+	if r > 0x7f || !strings.ContainsRune(HEX_CHARS, r) {
+		beep()
+		return
+	}
+
+	digit := hexDigitToInt(byte(r))
+	if editNibble == 0 && editInsert {
+		modifyDoc(true, func() { doc.Insert(cursor, []byte{digit << 4}) })
+		editNibble = 1
+		return
+	}
+
+	buf := make([]byte, 1)
+	if n, _ := reader.ReadAt(buf, cursor); n != 1 {
+		beep()
+		return
+	}
+
+	if editNibble == 0 {
+		editByte(cursor, buf[0]&0x0f|digit<<4)
+		editNibble = 1
+	} else {
+		editByte(cursor, buf[0]&0xf0|digit)
+		editNibble = 0
+		cursor++
+	}
+}
+
+func editChar(r rune) {
+	if r > 0xff {
+		beep()
+		return
+	}
+	if editInsert {
+		modifyDoc(true, func() { doc.Insert(cursor, []byte{byte(r)}) })
+	} else if cursor < fileSize {
+		editByte(cursor, byte(r))
+	} else {
+		beep()
+		return
+	}
+	cursor++
+}
+
+func editByte(pos int64, c byte) {
+	modifyDoc(true, func() { doc.Overwrite(pos, []byte{c}) })
+}
+
+// applies a change to the document as a single undo step, typing can be merged with the previous step
+func modifyDoc(typing bool, fn func()) {
+	before := doc.Snapshot()
+	fn()
+	undoJournal.RecordDoc(before, typing)
+	docChanged()
+}
+
+func saveEdits() {
+	if !doc.Modified() {
+		showMsg("no changes")
+		return
+	}
+	if !allowWrite {
+		showErrStr(ERR_WRITE_NOT_ALLOWED)
+		return
+	}
+	if !doc.IsIdentity() {
+		showError(errNotIdentity)
+		return
+	}
+	chunks, err := doc.Chunks()
+	if err != nil {
+		showError(err)
+		return
+	}
+	undoJournal.RecordDisk(chunks)
+	for i, c := range chunks {
+		if n, err := writeAt(c.Offset, c.New); err != nil {
+			undoJournal.KeepWritten(chunks, i, int64(n))
+			showError(err)
+			return
+		}
+		doc.Revert(c.Offset, int64(len(c.New)))
+	}
+	showMsg("saved")
+}
+
+// streams the whole document to a new file
+func saveAs(fname string) {
+	if fi, err := os.Stat(fname); err == nil {
+		if ofi, err := os.Stat(curSession.Path); err == nil && os.SameFile(fi, ofi) {
+			showErrStr("can't save over the file being viewed (hint: use :save)")
+			return
+		}
+		if !confirm(fname + " exists, overwrite? (y/n) ") {
+			return
+		}
+	}
+	if err := writeFile(fname, 0, fileSize); err != nil {
+		showError(err)
+		return
+	}
+	showMsg(fmt.Sprintf("saved 0x%x bytes to %s", fileSize, fname))
+}
+
+// returns true if it's ok to quit, asking the user if there are unsaved changes
+func confirmQuit() bool {
+	if !doc.Modified() {
+		return true
+	}
+	return confirm("unsaved changes, quit anyway? (y/n) ")
+}
@@ -1,111 +1,437 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 var OPS = []struct {
 	order int
-	op    byte
-	fn    func(a, b int64) int64
+	op    string
+	fn    func(a, b int64) (int64, error)
 }{
 	// https://en.cppreference.com/w/cpp/language/operator_precedence
-	{05, '*', func(a, b int64) int64 { return a * b }},
-	{05, '/', func(a, b int64) int64 { return a / b }},
-	{05, '%', func(a, b int64) int64 { return a % b }},
+	{5, "*", func(a, b int64) (int64, error) { return a * b, nil }},
+	{5, "/", func(a, b int64) (int64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	}},
+	{5, "%", func(a, b int64) (int64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a % b, nil
+	}},
+
+	{6, "+", func(a, b int64) (int64, error) { return a + b, nil }},
+	{6, "-", func(a, b int64) (int64, error) { return a - b, nil }},
+
+	{7, "<<", func(a, b int64) (int64, error) { return a << uint64(b), nil }},
+	{7, ">>", func(a, b int64) (int64, error) { return a >> uint64(b), nil }},
 
-	{06, '+', func(a, b int64) int64 { return a + b }},
-	{06, '-', func(a, b int64) int64 { return a - b }},
+	{9, "<", func(a, b int64) (int64, error) { return b2i(a < b), nil }},
+	{9, "<=", func(a, b int64) (int64, error) { return b2i(a <= b), nil }},
+	{9, ">", func(a, b int64) (int64, error) { return b2i(a > b), nil }},
+	{9, ">=", func(a, b int64) (int64, error) { return b2i(a >= b), nil }},
 
-	{11, '&', func(a, b int64) int64 { return a & b }},
-	{12, '^', func(a, b int64) int64 { return a ^ b }},
-	{13, '|', func(a, b int64) int64 { return a | b }},
+	{10, "==", func(a, b int64) (int64, error) { return b2i(a == b), nil }},
+	{10, "!=", func(a, b int64) (int64, error) { return b2i(a != b), nil }},
+
+	{11, "&", func(a, b int64) (int64, error) { return a & b, nil }},
+	{12, "^", func(a, b int64) (int64, error) { return a ^ b, nil }},
+	{13, "|", func(a, b int64) (int64, error) { return a | b, nil }},
+
+	{14, "&&", func(a, b int64) (int64, error) { return b2i(a != 0 && b != 0), nil }},
+	{15, "||", func(a, b int64) (int64, error) { return b2i(a != 0 || b != 0), nil }},
 }
 
 // used in ui.go
-var OPS_CHARS = func() string {
-	seen := make(map[byte]bool)
-	var ops []byte
-	for _, op := range OPS {
-		if !seen[op.op] {
-			seen[op.op] = true
-			ops = append(ops, op.op)
-		}
-	}
-	return string(ops)
-}()
+const OPS_CHARS = "*/%+-<>=!&^|~?:()"
 
 const (
 	HEX_CHARS       = "0123456789abcdefABCDEF"
 	SPACE           = " "
 	RADIX_MODIFIERS = "nNxXoO" // 'n' is for decimal
 	SPECIAL_VARS    = "$"      // here()
+	NAME_CHARS      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_[]@."
 )
 
-var EXPR_ALLOWED_CHARS = HEX_CHARS + OPS_CHARS + SPACE + RADIX_MODIFIERS + SPECIAL_VARS
+var EXPR_ALLOWED_CHARS = HEX_CHARS + OPS_CHARS + SPACE + RADIX_MODIFIERS + SPECIAL_VARS + NAME_CHARS
 
-var MAX_ORDER = func() int {
-	maxOrder := 0
-	for _, op := range OPS {
-		if op.order > maxOrder {
-			maxOrder = op.order
+// file(offset) is the address of a file offset, for offsets that look like mapped addresses
+const FILE_FUNC = "file"
+
+// sym(name) is a symbol, for names that are numbers too, i.e. "add"
+const SYM_FUNC = "sym"
+
+// functions reading a value from the file at the given address: qword($+18).
+// [expr] is the same as qword(expr)
+var DEREF_FUNCS = map[string]struct {
+	size      int
+	bigEndian bool
+}{
+	"byte":     {1, false},
+	"word":     {2, false},
+	"dword":    {4, false},
+	"qword":    {8, false},
+	"word_be":  {2, true},
+	"dword_be": {4, true},
+	"qword_be": {8, true},
+}
+
+// ternary operator, lowest precedence and right-associative
+const TERNARY_ORDER = 16
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type exprToken struct {
+	text string // "" at the end
+	col  int
+}
+
+// splits expr into numbers/words and operators, longest operator first
+func tokenizeExpr(expr string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '@' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9': // bookmark
+			tokens = append(tokens, exprToken{expr[i : i+2], i + 1})
+			i += 2
+		case isWordChar(c):
+			j := i
+			for j < len(expr) && isWordChar(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{expr[i:j], i + 1})
+			i = j
+		case i+1 < len(expr) && isExprOp(expr[i:i+2]):
+			tokens = append(tokens, exprToken{expr[i : i+2], i + 1})
+			i += 2
+		case isExprOp(expr[i:i+1]) || strings.IndexByte("!~?:()[]$", c) != -1:
+			tokens = append(tokens, exprToken{expr[i : i+1], i + 1})
+			i++
+		default:
+			return nil, fmt.Errorf("col %d: unexpected %q", i+1, c)
 		}
 	}
-	return maxOrder
-}()
+	return append(tokens, exprToken{"", len(expr) + 1}), nil
+}
+
+// numbers and names, '.' is for section names like .text
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z'
+}
 
-var MIN_ORDER = func() int {
-	minOrder := MAX_ORDER
+func isExprOp(s string) bool {
 	for _, op := range OPS {
-		if op.order < minOrder {
-			minOrder = op.order
+		if op.op == s {
+			return true
 		}
 	}
-	return minOrder
-}()
+	return false
+}
 
-// expects expr to be lowercase
-func parseExprRadix_(expr string, radix int) (int64, error) {
-	expr = strings.TrimSpace(expr)
+// precedence climbing parser, evaluating as it goes
+type exprParser struct {
+	tokens []exprToken
+	i      int
+	radix  int
+	skip   int // > 0 while parsing a branch that is not taken, i.e. no division by zero errors there
+}
 
-	for order := MAX_ORDER; order >= MIN_ORDER; order-- {
-		for _, op := range OPS {
-			if op.order != order {
-				continue
-			}
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
 
-			for i := 0; i < len(expr); i++ {
-				if expr[i] == op.op {
-					left, err := parseExprRadix(expr[:i], radix)
-					if err != nil {
-						return 0, err
-					}
-					right, err := parseExprRadix(expr[i+1:], radix)
-					if err != nil {
-						return 0, err
-					}
-					return op.fn(left, right), nil
-				}
-			}
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.i]
+	if t.text != "" {
+		p.i++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(t exprToken, format string, args ...interface{}) error {
+	return fmt.Errorf("col %d: %s", t.col, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) unexpected(t exprToken) error {
+	if t.text == "" {
+		return p.errorf(t, "unexpected end of expression")
+	}
+	return p.errorf(t, "unexpected %q", t.text)
+}
+
+func (p *exprParser) parseTernary() (int64, error) {
+	cond, err := p.parseBinary(TERNARY_ORDER - 1)
+	if err != nil || p.peek().text != "?" {
+		return cond, err
+	}
+	p.next()
+
+	if cond == 0 {
+		p.skip++
+	}
+	a, err := p.parseTernary()
+	if cond == 0 {
+		p.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if t := p.next(); t.text != ":" {
+		if t.text == "" {
+			return 0, p.errorf(t, "missing ':'")
+		}
+		return 0, p.unexpected(t)
+	}
+
+	if cond != 0 {
+		p.skip++
+	}
+	b, err := p.parseTernary()
+	if cond != 0 {
+		p.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+// binary operators of the given order and tighter
+func (p *exprParser) parseBinary(maxOrder int) (int64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		t := p.peek()
+		i := 0
+		for i < len(OPS) && OPS[i].op != t.text {
+			i++
+		}
+		if i == len(OPS) || OPS[i].order > maxOrder {
+			return left, nil
+		}
+		op := OPS[i]
+		p.next()
+
+		// the right side of && and || is not evaluated if the left one decides
+		lazy := op.op == "&&" && left == 0 || op.op == "||" && left != 0
+		if lazy {
+			p.skip++
+		}
+		right, err := p.parseBinary(op.order - 1) // left-associative
+		if lazy {
+			p.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+		if p.skip > 0 {
+			continue // value doesn't matter
+		}
+		if left, err = op.fn(left, right); err != nil {
+			return 0, p.errorf(t, "%s", err)
 		}
 	}
+}
 
-	expr = strings.TrimSpace(expr)
+func (p *exprParser) parseUnary() (int64, error) {
+	t := p.peek()
+	switch t.text {
+	case "-", "+", "~", "!":
+		p.next()
+		v, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch t.text {
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		case "!":
+			return b2i(v == 0), nil
+		}
+		return v, nil
+	}
+	return p.parsePrimary()
+}
 
-	if expr == "$" {
+func (p *exprParser) parsePrimary() (int64, error) {
+	t := p.next()
+	switch {
+	case t.text == "(":
+		return p.parseGroup(t, ")")
+	case t.text == "[":
+		ea, err := p.parseGroup(t, "]")
+		if err != nil {
+			return 0, err
+		}
+		return p.deref(t, ea, 8, false)
+	case t.text == "$":
 		return here(), nil
+	case t.text != "" && (isWordChar(t.text[0]) || t.text[0] == '@'):
+		if t.text == FILE_FUNC && p.peek().text == "(" {
+			off, err := p.parseGroup(p.next(), ")")
+			return offset2ea(off), err
+		}
+		if t.text == SYM_FUNC && p.peek().text == "(" {
+			return p.parseSym(p.next())
+		}
+		if f, ok := DEREF_FUNCS[t.text]; ok && p.peek().text == "(" {
+			ea, err := p.parseGroup(p.next(), ")")
+			if err != nil {
+				return 0, err
+			}
+			return p.deref(t, ea, f.size, f.bigEndian)
+		}
+		// numbers take precedence over names, i.e. a symbol "dead"
+		v, numErr := p.parseNumber(t)
+		if numErr == nil {
+			return v, nil
+		}
+		if v, ok, err := lookupExprName(t.text); ok {
+			if err != nil && p.skip == 0 {
+				return 0, p.errorf(t, "%s: %s", t.text, err)
+			}
+			return v, nil
+		}
+		return 0, numErr
+	}
+	return 0, p.unexpected(t)
+}
+
+func (p *exprParser) parseSym(open exprToken) (int64, error) {
+	t := p.next()
+	if t.text == "" || !isWordChar(t.text[0]) {
+		return 0, p.unexpected(t)
+	}
+	if c := p.next(); c.text != ")" {
+		if c.text == "" {
+			return 0, p.errorf(open, "missing ')'")
+		}
+		return 0, p.unexpected(c)
+	}
+	v, ok, err := lookupSymbol(t.text)
+	if p.skip > 0 {
+		return 0, nil
+	}
+	if !ok {
+		return 0, p.errorf(t, "unknown symbol: %s", t.text)
 	}
-	if strings.HasPrefix(expr, "0") && len(expr) > 2 {
-		switch expr[0:2] {
+	if err != nil {
+		return 0, p.errorf(t, "%s: %s", t.text, err)
+	}
+	return v, nil
+}
+
+// expression up to the closing bracket
+func (p *exprParser) parseGroup(open exprToken, close string) (int64, error) {
+	v, err := p.parseTernary()
+	if err != nil {
+		return 0, err
+	}
+	if c := p.next(); c.text != close {
+		if c.text == "" {
+			return 0, p.errorf(open, "missing '%s'", close)
+		}
+		return 0, p.unexpected(c)
+	}
+	return v, nil
+}
+
+func (p *exprParser) deref(t exprToken, ea int64, size int, bigEndian bool) (int64, error) {
+	if p.skip > 0 {
+		return 0, nil
+	}
+	v, err := readValue(ea, size, bigEndian)
+	if err != nil {
+		return 0, p.errorf(t, "%s", err)
+	}
+	return v, nil
+}
+
+// unsigned value of size bytes at address ea
+func readValue(ea int64, size int, bigEndian bool) (int64, error) {
+	off := ea2offset(ea)
+	if off < 0 || off+int64(size) > fileSize {
+		return 0, fmt.Errorf("read out of range: %X", ea)
+	}
+	buf := make([]byte, size)
+	if _, err := reader.ReadAt(buf, off); err != nil {
+		return 0, fmt.Errorf("read at %X: %w", ea, err)
+	}
+	v := uint64(0)
+	for i := range buf {
+		if bigEndian {
+			v = v<<8 | uint64(buf[i])
+		} else {
+			v |= uint64(buf[i]) << (8 * i)
+		}
+	}
+	return int64(v), nil
+}
+
+func (p *exprParser) parseNumber(t exprToken) (int64, error) {
+	s, radix := t.text, p.radix
+	if strings.HasPrefix(s, "0") && len(s) > 2 {
+		switch s[0:2] {
 		case "0x", "0o", "0b": // golang's supported prefixes
 			radix = 0
 		case "0n": // 0n123 - force decimal
 			radix = 10
-			expr = expr[2:]
+			s = s[2:]
+		}
+	}
+	n, err := strconv.ParseInt(s, radix, 64)
+	if err != nil {
+		// full 64-bit values, i.e. kernel addresses
+		if u, uerr := strconv.ParseUint(s, radix, 64); uerr == nil {
+			return int64(u), nil
+		}
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, p.errorf(t, "number out of range: %s", t.text)
 		}
+		return 0, p.errorf(t, "invalid number: %s", t.text)
+	}
+	return n, nil
+}
+
+// expects expr to be lowercase
+func parseExprRadix_(expr string, radix int) (int64, error) {
+	tokens, err := tokenizeExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+	p := &exprParser{tokens: tokens, radix: radix}
+	v, err := p.parseTernary()
+	if err != nil {
+		return 0, err
+	}
+	if t := p.next(); t.text != "" {
+		return 0, p.unexpected(t)
 	}
-	return strconv.ParseInt(expr, radix, 64)
+	return v, nil
 }
 
 func parseExprRadix(expr string, radix int) (int64, error) {
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// bytes 00..ff as the document, symbols "dead" (a hex number too) and "main", a user variable
+func setupExprTest(t *testing.T) {
+	data := make([]byte, 0x100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	openTestFile(t, data)
+
+	savedSymbols, savedByName, savedVars := symbols, symbolsByName, userVars
+	savedBase, savedMult, savedMap := base, baseMult, addrMap
+	t.Cleanup(func() {
+		symbols, symbolsByName, userVars = savedSymbols, savedByName, savedVars
+		base, baseMult, addrMap = savedBase, savedMult, savedMap
+	})
+	symbols = []Symbol{
+		{"dead", 0x20, 0x20, "func", 0x20},
+		{"main", 0x30, 0x30, "func", 0x30},
+		{"bss", 0x9000, -1, "object", -1},
+	}
+	symbolsByName = map[string]int{"dead": 0, "main": 1, "bss": 2}
+	userVars = map[string]int64{"myvar": 5}
+	base, baseMult, addrMap = 0, 1, nil
+	cursor = 0x10
+}
+
+func TestParseExpr(t *testing.T) {
+	setupExprTest(t)
+	tests := []struct {
+		expr  string
+		radix int
+		want  int64
+	}{
+		// precedence and associativity
+		{"10-4-3", 10, 3},
+		{"100/10/5", 10, 2},
+		{"2+3*4", 10, 14},
+		{"(2+3)*4", 10, 20},
+		{"1<<2+1", 10, 8},
+		{"1 & 3 | 4 ^ 1", 10, 5},
+		{"3<5 == 1", 10, 1},
+		{"2==2 && 3!=3", 10, 0},
+		{"0||7", 10, 1},
+		{"0?2:0?4:5", 10, 5},
+		// unary
+		{"-5+2", 10, -3},
+		{"- -3", 10, 3},
+		{"~0", 10, -1},
+		{"!0", 10, 1},
+		{"!5", 10, 0},
+		// branches not taken are not evaluated
+		{"0 ? 1/0 : 7", 10, 7},
+		{"0 && 1/0", 10, 0},
+		{"1 || 1%0", 10, 1},
+		// radix and prefixes
+		{"ff", 16, 0xff},
+		{"10", 0, 10},
+		{"0x10", 10, 0x10},
+		{"0n10", 16, 10},
+		{"0b101", 16, 5},
+		{"0o17", 16, 15},
+		{"FF", 16, 0xff},
+		{"ffffffffffffffff", 16, -1},
+		// names
+		{"$", 16, 0x10},
+		{"$+1", 16, 0x11},
+		{"main", 16, 0x30},
+		{"main+10", 16, 0x40},
+		{"dead", 16, 0xdead}, // numbers win over names
+		{"sym(dead)", 16, 0x20},
+		{"sym(main) - sym(dead)", 16, 0x10},
+		{"myvar * 2", 10, 10},
+		{"filesize", 16, 0x100},
+		// reads from the file
+		{"byte(10)", 16, 0x10},
+		{"word(10)", 16, 0x1110},
+		{"dword_be(10)", 16, 0x10111213},
+		{"[0]", 16, 0x0706050403020100},
+		{"byte($+1)", 16, 0x11},
+	}
+	for _, tt := range tests {
+		got, err := parseExprRadix(tt.expr, tt.radix)
+		if err != nil || got != tt.want {
+			t.Errorf("%q radix %d: %X, %v, want %X", tt.expr, tt.radix, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	setupExprTest(t)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "col 1: unexpected end of expression"},
+		{"1+", "col 3: unexpected end of expression"},
+		{"1 2", `col 3: unexpected "2"`},
+		{"1)", `col 2: unexpected ")"`},
+		{"(1+2", "col 1: missing ')'"},
+		{"[1", "col 1: missing ']'"},
+		{"1 ? 2", "missing ':'"},
+		{"1 # 2", "col 3: unexpected '#'"},
+		{"1/0", "col 2: division by zero"},
+		{"1%0", "col 2: division by zero"},
+		{"zz", "col 1: invalid number: zz"},
+		{"10000000000000000", "col 1: number out of range"},
+		{"sym(nope)", "col 5: unknown symbol: nope"},
+		{"sym(main", "col 4: missing ')'"},
+		{"sym(1+", `col 6: unexpected "+"`},
+		{"bss", "bss: not in the file"},
+		{"byte(1000)", "read out of range: 1000"},
+	}
+	for _, tt := range tests {
+		_, err := parseExprRadix(tt.expr, 16)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+// addresses are base + offset, file() converts an offset
+func TestParseExprBase(t *testing.T) {
+	setupExprTest(t)
+	base = 0x1000
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{"$", 0x1010},
+		{"file(10)", 0x1010},
+		{"main", 0x1030},
+		{"byte(1020)", 0x20},
+		{"byte(file(21))", 0x21},
+	}
+	for _, tt := range tests {
+		got, err := parseExprRadix(tt.expr, 16)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: %X, %v, want %X", tt.expr, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	MAX_FIND_ALL_HITS = 1000000
+	FIND_ALL_CONTEXT  = 4  // bytes before the hit shown in the preview
+	FIND_ALL_PREVIEW  = 16 // bytes from the hit shown in the preview
+)
+
+// background scan collecting all matches
+type findAllScan struct {
+	mu        sync.Mutex
+	hits      []int64
+	start     int64
+	end       int64
+	pos       atomic.Int64
+	cancelled atomic.Bool
+	truncated bool
+	err       error
+	done      chan struct{}
+}
+
+func startFindAll(m Matcher, start, end int64) *findAllScan {
+	s := &findAllScan{start: start, end: end, done: make(chan struct{})}
+	s.pos.Store(start)
+
+	go func() {
+		defer close(s.done)
+		defer screen.PostEvent(tcell.NewEventInterrupt(nil))
+
+		lastRedraw := time.Now()
+		err := scanForward(m, start, end,
+			func(pos int64) bool {
+				s.pos.Store(pos)
+				if time.Since(lastRedraw) >= progressInterval {
+					screen.PostEvent(tcell.NewEventInterrupt(nil))
+					lastRedraw = time.Now()
+				}
+				return !s.cancelled.Load()
+			},
+			func(pos int64) bool {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				if len(s.hits) >= MAX_FIND_ALL_HITS {
+					s.truncated = true
+					return false
+				}
+				s.hits = append(s.hits, pos)
+				return !s.cancelled.Load()
+			})
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		s.pos.Store(end)
+	}()
+	return s
+}
+
+func (s *findAllScan) Running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *findAllScan) Cancel() {
+	s.cancelled.Store(true)
+	<-s.done
+}
+
+func (s *findAllScan) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hits)
+}
+
+func (s *findAllScan) Hit(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[i]
+}
+
+func (s *findAllScan) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := fmt.Sprintf("%d hits", len(s.hits))
+	switch {
+	case s.Running():
+		pct := 100.0
+		if s.end > s.start {
+			pct = float64(s.pos.Load()-s.start) * 100 / float64(s.end-s.start)
+		}
+		status = fmt.Sprintf("scanning %0*X %5.1f%%  %s", offsetWidth, s.pos.Load(), pct, status)
+	case s.err != nil:
+		status += ", error: " + s.err.Error()
+	case s.truncated:
+		status += " (truncated)"
+	case s.cancelled.Load():
+		status += " (cancelled)"
+	}
+	return status
+}
+
+// offset and surrounding bytes
+func findAllPreview(pos int64) string {
+	from := max64(pos-FIND_ALL_CONTEXT, 0)
+	buf := make([]byte, pos-from+FIND_ALL_PREVIEW)
+	n, _ := reader.ReadAt(buf, from)
+	buf = buf[:n]
+
+	ctx := int(pos - from)
+	if ctx > len(buf) {
+		ctx = len(buf)
+	}
+	var ascii strings.Builder
+	for _, c := range buf[ctx:] {
+		ascii.WriteRune(ASCII_TBL[c])
+	}
+	return fmt.Sprintf("%0*X  %*s| %s %s", offsetWidth, offset2ea(pos),
+		FIND_ALL_CONTEXT*3, toHex(buf[:ctx], int64(ctx), 1), toHex(buf[ctx:], FIND_ALL_PREVIEW, 1), ascii.String())
+}
+
+func exportFindAll(s *findAllScan, fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for i, n := 0, s.Len(); i < n; i++ {
+		fmt.Fprintln(w, strings.TrimRight(findAllPreview(s.Hit(i)), " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// scans the whole file (or the selection) for all matches of the search pattern and shows them in a list
+func findAll() {
+	m, err := newMatcher(g_searchMode, g_searchFlags, g_searchPattern)
+	if err != nil {
+		showError(err)
+		return
+	}
+
+	fixSelection()
+	start, size := int64(0), fileSize
+	if selStart, selSize, ok := selection(); ok {
+		start, size = selStart, selSize
+	}
+
+	s := startFindAll(m, start, start+size)
+	defer s.Cancel()
+
+	panel := &ListPanel{
+		Title:  "find all: " + describePattern(g_searchMode, g_searchFlags, g_searchPattern),
+		Len:    s.Len,
+		Line:   func(i int) string { return findAllPreview(s.Hit(i)) },
+		Status: s.Status,
+		Keys:   "enter: go  w: export  esc: stop/close",
+	}
+	i := panel.Run(func(ev *tcell.EventKey, sel int) bool {
+		switch {
+		case ev.Key() == tcell.KeyEsc || ev.Key() == tcell.KeyCtrlC:
+			if s.Running() {
+				s.Cancel() // first Esc stops the scan, second closes the panel
+				return true
+			}
+		case ev.Key() == tcell.KeyRune && ev.Rune() == 'w':
+			if fname := askString("export to: ", "hits.txt"); fname != "" {
+				if err := exportFindAll(s, fname); err != nil {
+					showError(err)
+				} else {
+					showMsg(fmt.Sprintf("exported %d hits to %s", s.Len(), fname))
+				}
+			}
+			return true
+		}
+		return false
+	})
+
+	if i >= 0 {
+		pushBreadcrumb(-1)
+		setCursor(s.Hit(i))
+	}
+}
+
+func findAllUI() {
+	newPattern := askPattern("find all ", &g_searchMode, &g_searchFlags, SearchModeMax, g_searchPattern)
+	if len(newPattern) > 0 {
+		g_searchPattern = newPattern
+		findAll()
+	}
+}
+
+// human-readable search pattern
+func describePattern(mode, flags int, pattern []byte) string {
+	switch mode {
+	case SearchModeHex:
+		return strings.TrimSpace(toHex(pattern, int64(len(pattern)), 1))
+	case SearchModeRegex:
+		return "/" + string(pattern) + "/"
+	case SearchModeHexMask, SearchModeMulti:
+		return string(pattern)
+	case SearchModeNumber:
+		return fmt.Sprintf("%s [%s]", pattern, numFlagsString(flags))
+	case SearchModeText:
+		if flags&TEXT_FLAGS != 0 {
+			return fmt.Sprintf("%q [%s]", pattern, textFlagsString(flags&TEXT_FLAGS))
+		}
+	}
+	return fmt.Sprintf("%q", pattern)
+}
@@ -20,8 +20,13 @@ func processFlags() {
 	pflag.BoolVarP(&showASCII, "ascii", "A", true, "show ASCII representation")
 
 	pflag.Int64VarP(&base, "base", "b", 0, "base for offset (default: 0)")
+	pflag.StringVar(&addrMapFlag, "addr-map", "", "address map: 'auto' for ELF/PE/Mach-O segments, or a file with 'offset size address' lines")
 
 	pflag.BoolVarP(&allowWrite, "allow-write", "w", false, "allow write access")
+	pflag.BoolVar(&persistUndo, "undo-journal", true, "keep journal of file writes in the app dir, to be able to undo them later")
+	pflag.Int64Var(&searchWorkers, "search-workers", 0, "number of parallel search workers (default: number of CPUs)")
+
+	pflag.StringArrayVarP(&startupCmds, "command", "c", nil, "command to run at startup, after the rc file in the app dir (repeatable)")
 
 	pflag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] <filename> [offset]\n", os.Args[0])
@@ -38,13 +43,10 @@ func processFlags() {
 
 	fname = pos_args[0]
 
+	// evaluated once the file is open, with the saved base, symbols and address map
 	if len(pos_args) > 1 {
-		offset, err := parseExprRadix(pos_args[1], 16)
-		if err != nil {
-			fmt.Println("Error parsing offset:", err)
-			os.Exit(1)
-		}
-		gotoOffset(offset)
+		offsetArg = pos_args[1]
+		explicitOffset = true
 	}
 
 }
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	HASH_CHUNK_SIZE     = 1024 * 1024
+	MAX_CRC_FIND_SIZE   = 16 * 1024 * 1024 // biggest range searched for a crc, it is read into memory
+	MAX_CRC_FIND_STARTS = 4 * 1024 * 1024  // start positions of a crc find, 16 to 32 bytes of memory each
+)
+
+// crc with a table, poly in the normal (not reflected) form,
+// init is all zeros or all ones, so it's the same reflected or not
+type crcModel struct {
+	name   string
+	width  uint // 16 or 32
+	poly   uint32
+	init   uint32
+	refin  bool // reflected input and output
+	xorout uint32
+	table  [256]uint32
+	div8   [256]uint32 // low byte of a polynomial times x^-8
+	mod    [256]uint32 // i*x^width mod poly, the table of the not reflected form
+}
+
+var CRC_MODELS = []*crcModel{
+	{name: "crc16", width: 16, poly: 0x8005, init: 0, refin: true}, // arc, ibm
+	{name: "crc16-ccitt", width: 16, poly: 0x1021, init: 0xffff},   // ccitt-false
+	{name: "crc16-xmodem", width: 16, poly: 0x1021, init: 0},
+	{name: "crc16-kermit", width: 16, poly: 0x1021, init: 0, refin: true},
+	{name: "crc16-modbus", width: 16, poly: 0x8005, init: 0xffff, refin: true},
+	{name: "crc32", width: 32, poly: 0x04c11db7, init: 0xffffffff, refin: true, xorout: 0xffffffff},
+	{name: "crc32c", width: 32, poly: 0x1edc6f41, init: 0xffffffff, refin: true, xorout: 0xffffffff},
+}
+
+func init() {
+	for _, m := range CRC_MODELS {
+		m.makeTable()
+	}
+}
+
+func (m *crcModel) mask() uint32 {
+	return uint32(1<<m.width - 1)
+}
+
+func (m *crcModel) makeTable() {
+	top := uint32(1) << (m.width - 1)
+	for i := range m.mod {
+		crc := uint32(i) << (m.width - 8)
+		for k := 0; k < 8; k++ {
+			if crc&top != 0 {
+				crc = crc<<1 ^ m.poly
+			} else {
+				crc <<= 1
+			}
+		}
+		m.mod[i] = crc & m.mask()
+	}
+	for i := range m.div8 {
+		v := uint32(i)
+		for k := 0; k < 8; k++ {
+			if v&1 != 0 {
+				v = (v^m.poly)>>1 | top
+			} else {
+				v >>= 1
+			}
+		}
+		m.div8[i] = v
+	}
+	if !m.refin {
+		m.table = m.mod
+		return
+	}
+	rpoly := reverseBits(m.poly, m.width)
+	for i := range m.table {
+		crc := uint32(i)
+		for k := 0; k < 8; k++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ rpoly
+			} else {
+				crc >>= 1
+			}
+		}
+		m.table[i] = crc
+	}
+}
+
+func reverseBits(v uint32, width uint) uint32 {
+	r := uint32(0)
+	for i := uint(0); i < width; i++ {
+		r = r<<1 | v>>i&1
+	}
+	return r
+}
+
+// running crc register, before xorout
+func (m *crcModel) update(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = m.updateByte(crc, b)
+	}
+	return crc
+}
+
+func (m *crcModel) updateByte(crc uint32, b byte) uint32 {
+	if m.refin {
+		return m.table[byte(crc)^b] ^ crc>>8
+	}
+	return (m.table[byte(crc>>(m.width-8))^b] ^ crc<<8) & m.mask()
+}
+
+func (m *crcModel) final(crc uint32) uint32 {
+	return (crc ^ m.xorout) & m.mask()
+}
+
+// the register as a polynomial mod poly, x^0 in bit 0, reflected models keep it reversed
+func (m *crcModel) toPoly(crc uint32) uint32 {
+	if m.refin {
+		return reverseBits(crc, m.width)
+	}
+	return crc
+}
+
+// v * x^-8 mod poly, x has an inverse since poly has the +1 term
+func (m *crcModel) divX8(v uint32) uint32 {
+	return v>>8 ^ m.div8[byte(v)]
+}
+
+// b * v mod poly, b is the input byte as a polynomial
+func (m *crcModel) mulByte(b byte, v uint32) uint32 {
+	if m.refin {
+		b = bits.Reverse8(b)
+	}
+	r := uint64(0)
+	for k := 0; k < 8; k++ { // without branches, the bits are random
+		r ^= uint64(v) << k & -(uint64(b) >> k & 1)
+	}
+	return uint32(r)&m.mask() ^ m.mod[r>>m.width]
+}
+
+// first range data[s:e] with s < starts and a crc of target, by the end then the start, s -1 if none.
+// With P(i) the register after data[:i] from zero, the register of data[s:e] is x^8(e-s)*(init+P(s)) + P(e),
+// so the crc matches when x^-8s*(init+P(s)) == x^-8e*(init+P(e)) + x^-8e*(init+target^xorout).
+// Both sides are updated per byte, the left ones are kept in a hash table: linear in len(data).
+// stop is called every 64KiB with the position, true stops with errInterrupted
+func (m *crcModel) findRange(data []byte, starts int, target uint32, stop func(pos int) bool) (int, int, error) {
+	init := m.toPoly(m.init)
+	q := init                                         // x^-8i*(init+P(i))
+	pw := uint32(1) << (m.width - 8)                  // x^(width-8(i+1)), the next byte is b*x^width
+	iw := init                                        // x^-8i*init
+	tw := init ^ m.toPoly((target^m.xorout)&m.mask()) // x^-8i*(init+target^xorout)
+
+	// open addressing, q<<32 | s+1, the first s of a q is kept
+	size := 2
+	for size < 2*starts {
+		size <<= 1
+	}
+	table := make([]uint64, size)
+	slot := func(q uint32) int {
+		return int(uint64(q) * 0x9e3779b97f4a7c15 >> 32 & uint64(size-1))
+	}
+
+	for i := 0; i <= len(data); i++ {
+		if i&0xffff == 0 && i > 0 && stop(i) {
+			return -1, 0, errInterrupted
+		}
+		if i > 0 {
+			for j := slot(q ^ tw); table[j] != 0; j = (j + 1) & (size - 1) {
+				if uint32(table[j]>>32) == q^tw {
+					return int(uint32(table[j])) - 1, i, nil
+				}
+			}
+		}
+		if i < starts {
+			j := slot(q)
+			for table[j] != 0 && uint32(table[j]>>32) != q {
+				j = (j + 1) & (size - 1)
+			}
+			if table[j] == 0 {
+				table[j] = uint64(q)<<32 | uint64(i+1)
+			}
+		}
+		if i == len(data) {
+			break
+		}
+		niw := m.divX8(iw)
+		q ^= m.mulByte(data[i], pw) ^ iw ^ niw
+		iw, pw, tw = niw, m.divX8(pw), m.divX8(tw)
+	}
+	return -1, 0, nil
+}
+
+func findCRCModel(name string) *crcModel {
+	for _, m := range CRC_MODELS {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// hash.Hash of a crc model, the sum is big-endian like hash/crc32
+type crcHash struct {
+	m   *crcModel
+	crc uint32
+}
+
+func (h *crcHash) Write(p []byte) (int, error) {
+	h.crc = h.m.update(h.crc, p)
+	return len(p), nil
+}
+
+func (h *crcHash) Sum(b []byte) []byte {
+	v := h.m.final(h.crc)
+	for i := int(h.m.width/8) - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func (h *crcHash) Reset()         { h.crc = h.m.init }
+func (h *crcHash) Size() int      { return int(h.m.width / 8) }
+func (h *crcHash) BlockSize() int { return 1 }
+
+func newCRCHash(name string) func() hash.Hash {
+	return func() hash.Hash {
+		m := findCRCModel(name)
+		return &crcHash{m, m.init}
+	}
+}
+
+// the stdlib ones for crc32 are faster
+var HASH_ALGOS = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"md5", md5.New},
+	{"sha1", sha1.New},
+	{"sha256", sha256.New},
+	{"sha512", sha512.New},
+	{"crc32", func() hash.Hash { return crc32.NewIEEE() }},
+	{"crc32c", func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+	{"crc16", newCRCHash("crc16")},
+	{"crc16-ccitt", newCRCHash("crc16-ccitt")},
+	{"crc16-xmodem", newCRCHash("crc16-xmodem")},
+	{"crc16-kermit", newCRCHash("crc16-kermit")},
+	{"crc16-modbus", newCRCHash("crc16-modbus")},
+	{"adler32", func() hash.Hash { return adler32.New() }},
+}
+
+func hashAlgoNames() []string {
+	names := make([]string, 0, len(HASH_ALGOS))
+	for _, a := range HASH_ALGOS {
+		names = append(names, a.name)
+	}
+	return names
+}
+
+// comma-separated algorithm names or "all", indexes into HASH_ALGOS
+func parseHashAlgos(s string) ([]int, error) {
+	if s == "all" {
+		algos := make([]int, len(HASH_ALGOS))
+		for i := range algos {
+			algos[i] = i
+		}
+		return algos, nil
+	}
+	algos := make([]int, 0)
+outer:
+	for _, name := range strings.Split(strings.ToLower(s), ",") {
+		for i, a := range HASH_ALGOS {
+			if a.name == name {
+				algos = append(algos, i)
+				continue outer
+			}
+		}
+		return nil, fmt.Errorf("unknown algorithm: %s (%s)", name, strings.Join(hashAlgoNames(), ", "))
+	}
+	return algos, nil
+}
+
+var errInterrupted = errors.New("interrupted")
+
+// reads the range in chunks with progress until fn returns false, esc/q interrupts
+func scanRange(start, size int64, fn func(data []byte, pos int64) bool) error {
+	buf := make([]byte, min64(size, HASH_CHUNK_SIZE))
+	resetProgress()
+	for pos, end := start, start+size; pos < end; {
+		n := min64(end-pos, int64(len(buf)))
+		if _, err := reader.ReadAt(buf[:n], pos); err != nil && err != io.EOF {
+			return err
+		}
+		if !fn(buf[:n], pos) {
+			return nil
+		}
+		pos += n
+		if checkInterrupt() {
+			return errInterrupted
+		}
+		updateProgress(pos)
+	}
+	return nil
+}
+
+// range from the arguments, the selection, or the whole file
+func hashRange(what string, a []string) (int64, int64, bool) {
+	switch len(a) {
+	case 0:
+		fixSelection()
+		if start, size, ok := selection(); ok {
+			return start, size, true
+		}
+		if fileSize == 0 {
+			showErrStr(what, ": empty file")
+			return 0, 0, false
+		}
+		return 0, fileSize, true
+	case 2:
+		return parseRange(what, a[0], a[1])
+	}
+	showErrStr(what, ": need <start> <len>, a selection, or nothing for the whole file")
+	return 0, 0, false
+}
+
+// first word and the rest
+func cutWord(args string) (string, string) {
+	word, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	return word, strings.TrimSpace(rest)
+}
+
+// hash [algo,...|all] [<start> <len>], hash find <crc> [algo] [<start> <len>]
+func cmd_hash(args string) {
+	word, rest := cutWord(args)
+	if word == "find" {
+		findCRC(rest)
+		return
+	}
+
+	algos, _ := parseHashAlgos("all")
+	if word != "" {
+		if a, err := parseHashAlgos(word); err == nil {
+			algos, args = a, rest
+		} else if len(cutArgs(args, 2)) == 1 {
+			showErrStr("hash: ", err)
+			return
+		}
+	}
+	start, size, ok := hashRange("hash", cutArgs(args, 2))
+	if !ok {
+		return
+	}
+
+	hashes := make([]hash.Hash, len(algos))
+	writers := make([]io.Writer, len(algos))
+	for i, algo := range algos {
+		hashes[i] = HASH_ALGOS[algo].new()
+		writers[i] = hashes[i]
+	}
+	w := io.MultiWriter(writers...)
+	err := scanRange(start, size, func(data []byte, pos int64) bool {
+		w.Write(data)
+		return true
+	})
+	if err == errInterrupted {
+		showMsg("hash: interrupted")
+		return
+	}
+	if err != nil {
+		showError(err)
+		return
+	}
+
+	lines := make([]string, len(algos))
+	for i, algo := range algos {
+		lines[i] = fmt.Sprintf("%-14s %s", HASH_ALGOS[algo].name, strings.ToUpper(hex.EncodeToString(hashes[i].Sum(nil))))
+	}
+	showHashes(fmt.Sprintf("hash %X+%X", offset2ea(start), size), lines)
+}
+
+// enter shows the value alone in the status line, to copy it from the terminal
+func showHashes(title string, lines []string) {
+	panel := &ListPanel{
+		Title: title,
+		Len:   func() int { return len(lines) },
+		Line:  func(i int) string { return lines[i] },
+		Keys:  "enter: show value  w: write to file  esc: close",
+	}
+	i := panel.Run(func(ev *tcell.EventKey, sel int) bool {
+		if ev.Key() == tcell.KeyRune && ev.Rune() == 'w' {
+			if fname := askString("write to: ", "hashes.txt"); fname != "" {
+				data := title + "\n" + strings.Join(lines, "\n") + "\n"
+				if err := os.WriteFile(fname, []byte(data), 0666); err != nil {
+					showError(err)
+				} else {
+					showMsg("written to " + fname)
+				}
+			}
+			return true
+		}
+		return false
+	})
+	if i >= 0 {
+		f := strings.Fields(lines[i])
+		showMsg(f[len(f)-1])
+	}
+}
+
+// hash find <crc> [algo] [<start> <len>]: the first range to end giving the crc, starting anywhere in the selection
+// (or at the cursor without one) and ending after the start in the selection (or up to MAX_CRC_FIND_SIZE).
+// Without an algorithm the 32-bit crcs are tried, a 16-bit one matches random data every 64KiB
+func findCRC(args string) {
+	word, args := cutWord(args)
+	if word == "" {
+		showErrStr("hash find: need <crc> [algo] [<start> <len>]")
+		return
+	}
+	target, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(word), "0x"), 16, 32)
+	if err != nil {
+		showErrStr("hash find: invalid crc: ", word)
+		return
+	}
+
+	models := make([]*crcModel, 0)
+	if word, rest := cutWord(args); strings.HasPrefix(strings.ToLower(word), "crc") {
+		m := findCRCModel(strings.ToLower(word))
+		if m == nil {
+			names := make([]string, len(CRC_MODELS))
+			for i, m := range CRC_MODELS {
+				names[i] = m.name
+			}
+			showErrStr("hash find: unknown crc: ", word, " (", strings.Join(names, ", "), ")")
+			return
+		}
+		if uint32(target)&^m.mask() != 0 {
+			showErrStr(fmt.Sprintf("hash find: %X is too big for %s", target, m.name))
+			return
+		}
+		models = append(models, m)
+		args = rest
+	} else {
+		for _, m := range CRC_MODELS {
+			if m.width == 32 {
+				models = append(models, m)
+			}
+		}
+	}
+
+	a := cutArgs(args, 2)
+	var first, last, end int64 // starts first..last, ranges end up to end
+	switch len(a) {
+	case 0:
+		fixSelection()
+		if start, size, ok := selection(); ok {
+			first, last, end = start, start+size-1, start+size
+		} else {
+			first, last, end = cursor, cursor, min64(fileSize, cursor+MAX_CRC_FIND_SIZE)
+		}
+	case 2:
+		start, size, ok := parseRange("hash find", a[0], a[1])
+		if !ok {
+			return
+		}
+		first, last, end = start, start+size-1, start+size
+	default:
+		showErrStr("hash find: need <crc> [algo] [<start> <len>]")
+		return
+	}
+	if first >= end {
+		showErrStr("hash find: empty range")
+		return
+	}
+	if end-first > MAX_CRC_FIND_SIZE {
+		showErrStr(fmt.Sprintf("hash find: range too big, max 0x%x bytes", MAX_CRC_FIND_SIZE))
+		return
+	}
+	if last-first >= MAX_CRC_FIND_STARTS {
+		showErrStr(fmt.Sprintf("hash find: too many starts, max 0x%x", MAX_CRC_FIND_STARTS))
+		return
+	}
+
+	// the whole range is read once, then each model checks it in memory
+	data := make([]byte, 0, end-first)
+	err = scanRange(first, end-first, func(chunk []byte, pos int64) bool {
+		data = append(data, chunk...)
+		return true
+	})
+	if err == errInterrupted {
+		showMsg("hash find: interrupted")
+		return
+	}
+	if err != nil {
+		showError(err)
+		return
+	}
+
+	resetProgress()
+	var found *crcModel
+	var start, size int64
+	for _, m := range models {
+		s, e, err := m.findRange(data, int(last-first)+1, uint32(target), func(pos int) bool {
+			updateProgress(first + int64(pos))
+			return checkInterrupt()
+		})
+		if err != nil {
+			showMsg("hash find: interrupted")
+			return
+		}
+		if s >= 0 && (found == nil || first+int64(e) < start+size) {
+			found, start, size = m, first+int64(s), int64(e-s)
+		}
+	}
+	if found != nil {
+		pushBreadcrumb(-1)
+		selectRange(start, size)
+		setCursor(start)
+		showMsg(fmt.Sprintf("%s %X: %X+%X", found.name, target, offset2ea(start), size))
+		return
+	}
+	showErrStr(fmt.Sprintf("hash find: crc %X not found", target))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+// check values of the models, the crc of "123456789"
+func TestCRCModels(t *testing.T) {
+	want := map[string]uint32{
+		"crc16":        0xbb3d,
+		"crc16-ccitt":  0x29b1,
+		"crc16-xmodem": 0x31c3,
+		"crc16-kermit": 0x2189,
+		"crc16-modbus": 0x4b37,
+		"crc32":        0xcbf43926,
+		"crc32c":       0xe3069283,
+	}
+	for _, m := range CRC_MODELS {
+		if got := m.final(m.update(m.init, []byte("123456789"))); got != want[m.name] {
+			t.Errorf("%s: %X, want %X", m.name, got, want[m.name])
+		}
+	}
+
+	// the table models agree with the stdlib, also when written in parts
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, tt := range []struct {
+		name  string
+		table *crc32.Table
+	}{
+		{"crc32", crc32.IEEETable},
+		{"crc32c", crc32.MakeTable(crc32.Castagnoli)},
+	} {
+		h := newCRCHash(tt.name)()
+		h.Write(data[:123])
+		h.Write(data[123:])
+		if got, want := fmt.Sprintf("%x", h.Sum(nil)), fmt.Sprintf("%08x", crc32.Checksum(data, tt.table)); got != want {
+			t.Errorf("%s: %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+// findRange against trying every range, by the end then the start
+func TestCRCFindRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 150)
+	rnd.Read(data)
+	for _, m := range CRC_MODELS {
+		for round := 0; round < 20; round++ {
+			starts := rnd.Intn(len(data)) + 1
+			s := rnd.Intn(starts)
+			e := s + 1 + rnd.Intn(len(data)-s)
+			target := m.final(m.update(m.init, data[s:e]))
+			if round%5 == 0 {
+				target = rnd.Uint32() & m.mask() // mostly not found
+			}
+
+			wantS, wantE := -1, 0
+			for e := 1; e <= len(data) && wantS == -1; e++ {
+				for s := 0; s < starts && s < e; s++ {
+					if m.final(m.update(m.init, data[s:e])) == target {
+						wantS, wantE = s, e
+						break
+					}
+				}
+			}
+			gotS, gotE, err := m.findRange(data, starts, target, func(int) bool { return false })
+			if err != nil || gotS != wantS || gotS != -1 && gotE != wantE {
+				t.Errorf("%s %X in %d starts: %d..%d %v, want %d..%d", m.name, target, starts, gotS, gotE, err, wantS, wantE)
+			}
+		}
+	}
+}
+
+func TestParseHashAlgos(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string // names, "" for an error
+	}{
+		{"md5", "[md5]"},
+		{"CRC32,sha1", "[crc32 sha1]"},
+		{"crc16-modbus", "[crc16-modbus]"},
+		{"md5,", ""},
+		{"foo", ""},
+	}
+	for _, tt := range tests {
+		algos, err := parseHashAlgos(tt.s)
+		got := ""
+		if err == nil {
+			names := make([]string, len(algos))
+			for i, a := range algos {
+				names[i] = HASH_ALGOS[a].name
+			}
+			got = fmt.Sprint(names)
+		}
+		if got != tt.want {
+			t.Errorf("%q: %s %v, want %s", tt.s, got, err, tt.want)
+		}
+	}
+	if all, _ := parseHashAlgos("all"); len(all) != len(HASH_ALGOS) {
+		t.Error("all:", all)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func init() {
+	addCommand("help", cmd_help, "[command]", "list of keys, commands and variables, or usage of a command")
+}
+
+// keys bound to the action or ":command"
+func keysOf(binding string) []string {
+	keys := make([]string, 0)
+	for k, b := range keyBindings {
+		if b == binding {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func commandUsage(c Command) string {
+	if c.usage == "" {
+		return ":" + c.name
+	}
+	return ":" + c.name + " " + c.usage
+}
+
+// generated from the key bindings, COMMANDS and INT_VARS
+func helpLines() []string {
+	lines := []string{"keys"}
+	for _, a := range ACTIONS {
+		if a.name == "none" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %-20s %-20s %s", strings.Join(keysOf(a.name), " "), a.name, a.help))
+	}
+	cmdKeys := make([]string, 0)
+	for k, b := range keyBindings {
+		if strings.HasPrefix(b, ":") {
+			cmdKeys = append(cmdKeys, k)
+		}
+	}
+	sort.Strings(cmdKeys)
+	for _, k := range cmdKeys {
+		lines = append(lines, fmt.Sprintf("  %-20s %s", k, keyBindings[k]))
+	}
+
+	lines = append(lines, "", "commands, any unique prefix works")
+	for _, c := range COMMANDS {
+		lines = append(lines, fmt.Sprintf("  %-42s %s", commandUsage(c), c.help))
+	}
+
+	lines = append(lines, "", "variables, for :set and expressions")
+	for _, v := range INT_VARS {
+		lines = append(lines, fmt.Sprintf("  %-20s %s", v.name, v.help))
+	}
+	lines = append(lines,
+		fmt.Sprintf("  %-20s %s", "fileSize", "size of the file"),
+		fmt.Sprintf("  %-20s %s", "selStart selEnd", "selection bounds"),
+		fmt.Sprintf("  %-20s %s", "@1 .. @0", "bookmarks"),
+		fmt.Sprintf("  %-20s %s", "$", "cursor"),
+		"",
+		"expressions: hex numbers by default (0n decimal), C operators, c ? a : b, byte() word() dword() qword() [x],",
+		"  file(x) for file offsets, symbol names (sym(x) for the ones looking like numbers), :let variables",
+	)
+	return lines
+}
+
+func showHelp() {
+	all := helpLines()
+	lines := all
+	filter := ""
+	panel := &ListPanel{
+		Title: "help",
+		Len:   func() int { return len(lines) },
+		Line:  func(i int) string { return lines[i] },
+		Keys:  "/: filter  esc: close",
+	}
+	panel.Run(func(ev *tcell.EventKey, sel int) bool {
+		if ev.Key() == tcell.KeyRune && ev.Rune() == '/' {
+			str, key := ask("filter: ", filter, "", false)
+			if key != tcell.KeyEsc && key != tcell.KeyCtrlC {
+				filter = str
+				lines = make([]string, 0)
+				for _, l := range all {
+					if strings.Contains(strings.ToLower(l), strings.ToLower(filter)) {
+						lines = append(lines, l)
+					}
+				}
+				panel.Title = "help"
+				if filter != "" {
+					panel.Title += ": " + filter
+				}
+				panel.sel, panel.top = 0, 0
+			}
+			return true
+		}
+		return false
+	})
+}
+
+// help [command]
+func cmd_help(args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		showHelp()
+		return
+	}
+	names, exact := matchCommands(args)
+	if len(names) == 0 {
+		showErrStr("help: unknown command: ", args)
+		return
+	}
+	msgs := make([]string, 0)
+	for _, c := range COMMANDS {
+		if exact && c.name == args || !exact && strings.HasPrefix(c.name, args) {
+			msgs = append(msgs, commandUsage(c)+"  "+c.help)
+		}
+	}
+	showMsg(strings.Join(msgs, "; "))
+}
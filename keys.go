@@ -0,0 +1,521 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// state of the key event being handled by an action
+type keyEvent struct {
+	dir       int // page scroll direction
+	cursorDir int // vertical cursor movement direction
+	quit      bool
+}
+
+type Action struct {
+	name string
+	help string
+	fn   func(k *keyEvent)
+}
+
+// filled in init(), the actions refer to run_cmd
+var (
+	ACTIONS       []Action
+	actionsByName map[string]int
+)
+
+// key name -> action name, or ":command"
+var keyBindings = make(map[string]string)
+
+var DEFAULT_KEYS = []struct{ key, action string }{
+	{"Left", "left"},
+	{"Right", "right"},
+	{"Up", "up"},
+	{"Down", "down"},
+	{"Shift-Left", "realign-left"},
+	{"Shift-Right", "realign-right"},
+	{"PgDn", "page-down"},
+	{"Space", "page-down"},
+	{"PgUp", "page-up"},
+	{"Home", "home"},
+	{"End", "end"},
+	{"G", "end"},
+	{"Backspace", "back"},
+	{"Tab", "display-mode"},
+	{"Enter", "display-mode"},
+	{"Esc", "escape"},
+	{"Ctrl-C", "quit"},
+	{"q", "quit"},
+	{"Q", "quit"},
+	{"Ctrl-S", "save"},
+	{"Ctrl-Z", "undo"},
+	{"Ctrl-Y", "redo"},
+	{"Ctrl-G", "goto"},
+	{"g", "goto"},
+	{":", "command"},
+
+	{"-", "cols-dec"},
+	{"_", "cols-half"},
+	{"=", "cols-inc"},
+	{"+", "cols-double"},
+	{"0", "cols-auto"},
+	{"c", "cols"},
+	{"w", "cols"},
+	{"1", "width-1"},
+	{"2", "width-2"},
+	{"4", "width-4"},
+	{"8", "width-8"},
+	{"9", "width-16"},
+	{"p", "page-size"},
+
+	{"a", "toggle-ascii"},
+	{"b", "toggle-binary"},
+	{"B", "toggle-binary-01"},
+	{"C", "toggle-colors"},
+	{"h", "toggle-hex"},
+	{"d", "toggle-dedup"},
+	{"u", "toggle-unicode"},
+	{"U", "toggle-unicode-mode"},
+
+	{"e", "edit"},
+	{"P", "patch"},
+	{"W", "write"},
+	{"v", "select"},
+	{"/", "search"},
+	{"?", "search-back"},
+	{"n", "search-next"},
+	{"N", "search-prev"},
+	{"f", "find-all"},
+	{"I", "stats"},
+	{"S", "symbols"},
+	{"m", "macro-record"},
+	{"M", "macro-play"},
+	{"F1", "help"},
+
+	{"!", "bookmark-1"},
+	{"@", "bookmark-2"},
+	{"#", "bookmark-3"},
+	{"$", "bookmark-4"},
+	{"%", "bookmark-5"},
+	{"^", "bookmark-6"},
+	{"&", "bookmark-7"},
+	{"*", "bookmark-8"},
+	{"(", "bookmark-9"},
+	{")", "bookmark-0"},
+}
+
+func init() {
+	ACTIONS = []Action{
+		{"none", "do nothing, for unbinding keys", func(k *keyEvent) {}},
+		{"left", "cursor left", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyLeft)
+			cursor -= int64(elWidth)
+		}},
+		{"right", "cursor right", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyRight)
+			cursor += int64(elWidth)
+		}},
+		{"up", "cursor up", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyUp)
+			k.cursorDir = -1
+			cursor -= cols
+		}},
+		{"down", "cursor down", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyDown)
+			k.cursorDir = 1
+			cursor += cols
+		}},
+		{"realign-left", "shift the page origin one byte left, i.e. realign columns", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyLeft)
+			offset -= 1
+			cursor -= 1
+			invalidateSkips()
+		}},
+		{"realign-right", "shift the page origin one byte right", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyRight)
+			offset += 1
+			cursor += 1
+			invalidateSkips()
+		}},
+		{"page-down", "next page", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyPgDn)
+			k.dir = 1
+			if pageSize == 0 {
+				scrollPage(nextOffset - offset)
+			} else {
+				scrollPage(pageSize)
+			}
+		}},
+		{"page-up", "previous page", func(k *keyEvent) {
+			// efficiently handle skipping over deduplicated lines
+			if len(breadcrumbs) > 0 && breadcrumbs[len(breadcrumbs)-1].key == tcell.KeyPgDn {
+				popBreadcrumb()
+			} else {
+				pushBreadcrumb(tcell.KeyPgUp)
+				if pageSize == 0 {
+					scrollPage(-cols * int64(maxLinesPerPage))
+				} else {
+					scrollPage(-pageSize)
+				}
+			}
+			k.dir = -1
+		}},
+		{"home", "start of the file", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyHome)
+			offset = 0
+			cursor = 0
+		}},
+		{"end", "end of the file", func(k *keyEvent) {
+			pushBreadcrumb(tcell.KeyEnd)
+			offset = lastPageOffset()
+			cursor = fileSize - 1
+		}},
+		{"back", "go back to the previous position", func(k *keyEvent) { popBreadcrumb() }},
+		{"display-mode", "next display mode", func(k *keyEvent) {
+			dispMode += 1
+			if dispMode > DispModeMax {
+				dispMode = 0
+			}
+		}},
+		{"escape", "clear the selection, or quit", func(k *keyEvent) {
+			if selActive {
+				clearSelection()
+			} else {
+				k.quit = confirmQuit()
+			}
+		}},
+		{"quit", "quit", func(k *keyEvent) { k.quit = confirmQuit() }},
+		{"save", "save changes", func(k *keyEvent) { saveEdits() }},
+		{"undo", "undo", func(k *keyEvent) { undo() }},
+		{"redo", "redo", func(k *keyEvent) { redo() }},
+		{"goto", "go to offset", func(k *keyEvent) {
+			new_offset := askOffset("[hex] offset: ", here())
+			if new_offset != here() {
+				gotoOffset(new_offset)
+			}
+		}},
+		{"command", "enter a : command", func(k *keyEvent) {
+			mark := recordMark()
+			cmd := askCommand()
+			recordCommand(mark, cmd) // as a command, not the keys typed
+			if cmd != "" {
+				run_cmd(cmd)
+			}
+		}},
+
+		{"cols-dec", "one element less per line", func(k *keyEvent) {
+			customColsMode = true
+			defaultColsMode = 1
+			if cols-int64(elWidth) > 0 {
+				cols -= int64(elWidth)
+				invalidateSkips()
+			}
+		}},
+		{"cols-half", "half the columns", func(k *keyEvent) {
+			customColsMode = true
+			defaultColsMode = 1
+			if cols > 1 {
+				cols /= 2
+				invalidateSkips()
+			}
+		}},
+		{"cols-inc", "one element more per line", func(k *keyEvent) {
+			customColsMode = true
+			defaultColsMode = 1
+			cols += int64(elWidth)
+			invalidateSkips()
+		}},
+		{"cols-double", "double the columns", func(k *keyEvent) {
+			customColsMode = true
+			defaultColsMode = 1
+			cols *= 2
+			invalidateSkips()
+		}},
+		{"cols-auto", "automatic number of columns, switches between the default modes", func(k *keyEvent) {
+			customColsMode = false
+			defaultColsMode = 1 - defaultColsMode
+			calcDefaultCols(scrWidth)
+		}},
+		{"cols", "ask for the number of columns", func(k *keyEvent) { setCols(askInt("cols: ", cols)) }},
+		{"width-1", "1-byte elements", func(k *keyEvent) { elWidth = 1 }},
+		{"width-2", "2-byte elements", func(k *keyEvent) { elWidth = 2 }},
+		{"width-4", "4-byte elements", func(k *keyEvent) { elWidth = 4 }},
+		{"width-8", "8-byte elements", func(k *keyEvent) { elWidth = 8 }},
+		{"width-16", "16-byte elements", func(k *keyEvent) { elWidth = 0x10 }},
+		{"page-size", "ask for the page size", func(k *keyEvent) {
+			pageSize = askInt("page size (0 = auto): ", pageSize)
+		}},
+
+		{"toggle-ascii", "show/hide ASCII", func(k *keyEvent) { showASCII = !showASCII }},
+		{"toggle-binary", "show/hide binary", func(k *keyEvent) { showBin = !showBin }},
+		{"toggle-binary-01", "binary as 0/1 or _/X", func(k *keyEvent) { binMode01 = !binMode01 }},
+		{"toggle-colors", "gray bytes below 0x10", func(k *keyEvent) { altColorMode = !altColorMode }},
+		{"toggle-hex", "show/hide hex", func(k *keyEvent) { showHex = !showHex }},
+		{"toggle-dedup", "hide duplicate lines on/off", func(k *keyEvent) { g_dedup = !g_dedup }},
+		{"toggle-unicode", "show/hide UTF-16", func(k *keyEvent) { showUnicode = !showUnicode }},
+		{"toggle-unicode-mode", "UTF-16 little/big endian", func(k *keyEvent) { unicodeMode = !unicodeMode }},
+
+		{"edit", "edit mode", func(k *keyEvent) { enterEditMode() }},
+		{"patch", "patch the file in place", func(k *keyEvent) { patchUI() }},
+		{"write", "write a range to a file", func(k *keyEvent) { writeUI() }},
+		{"select", "start/fix the selection", func(k *keyEvent) { toggleSelection() }},
+		{"search", "search forward", func(k *keyEvent) { searchUI(true) }},
+		{"search-back", "search backward", func(k *keyEvent) { searchUI(false) }},
+		{"search-next", "next match", func(k *keyEvent) {
+			if !searchNext() {
+				beep()
+			}
+		}},
+		{"search-prev", "previous match", func(k *keyEvent) {
+			if !searchPrev() {
+				beep()
+			}
+		}},
+		{"find-all", "find all matches", func(k *keyEvent) { findAllUI() }},
+		{"stats", "byte statistics of the selection or the file", func(k *keyEvent) { cmd_stats("") }},
+		{"symbols", "list of symbols", func(k *keyEvent) { showSymbols("") }},
+		{"macro-record", "start recording a macro into a register, or stop recording", func(k *keyEvent) { macroRecordKey() }},
+		{"macro-play", "play a macro from a register", func(k *keyEvent) { macroPlayKey() }},
+		{"help", "this help", func(k *keyEvent) { showHelp() }},
+	}
+	for i := 0; i < 10; i++ {
+		n := i
+		ACTIONS = append(ACTIONS,
+			Action{fmt.Sprintf("bookmark-%d", n), fmt.Sprintf("set bookmark %d", n), func(k *keyEvent) { setBookmark(n) }},
+			Action{fmt.Sprintf("goto-bookmark-%d", n), fmt.Sprintf("go to bookmark %d", n), func(k *keyEvent) { gotoBookmark(n) }},
+		)
+		DEFAULT_KEYS = append(DEFAULT_KEYS, struct{ key, action string }{fmt.Sprintf("Alt-%d", n), fmt.Sprintf("goto-bookmark-%d", n)})
+	}
+
+	actionsByName = make(map[string]int)
+	for i, a := range ACTIONS {
+		actionsByName[a.name] = i
+	}
+	for _, b := range DEFAULT_KEYS {
+		key, err := parseKeyName(b.key)
+		if err != nil {
+			panic(err)
+		}
+		keyBindings[key] = b.action
+	}
+
+	addCommand("map", cmd_map, "[<key> <action> | <key> :<command>]", "bind a key, lists the bindings without arguments")
+}
+
+// runs the action or command bound to the key, the unmodified key's for a modified special key without a binding (Ctrl-Left is Left)
+func runKey(ev *tcell.EventKey, k *keyEvent) {
+	b, ok := keyBindings[keyName(ev)]
+	if !ok && ev.Key() != tcell.KeyRune && ev.Modifiers() != 0 {
+		b, ok = keyBindings[keyName(tcell.NewEventKey(ev.Key(), 0, 0))]
+	}
+	if !ok {
+		return
+	}
+	if strings.HasPrefix(b, ":") {
+		run_cmd(b[1:])
+		return
+	}
+	ACTIONS[actionsByName[b]].fn(k)
+}
+
+// names of the keys as in tcell, "Ctrl-", "Alt-" and "Shift-" modifiers in this order
+func modPrefix(mods tcell.ModMask) string {
+	s := ""
+	if mods&tcell.ModCtrl != 0 {
+		s += "Ctrl-"
+	}
+	if mods&(tcell.ModAlt|tcell.ModMeta) != 0 {
+		s += "Alt-"
+	}
+	if mods&tcell.ModShift != 0 {
+		s += "Shift-"
+	}
+	return s
+}
+
+func keyName(ev *tcell.EventKey) string {
+	k, mods := ev.Key(), ev.Modifiers()
+	if k == tcell.KeyRune {
+		if ev.Rune() == ' ' {
+			return modPrefix(mods) + "Space"
+		}
+		return modPrefix(mods&^tcell.ModShift) + string(ev.Rune()) // shift is in the rune
+	}
+	switch {
+	case k == tcell.KeyBackspace2:
+		k = tcell.KeyBackspace
+	case k == tcell.KeyTab && mods&tcell.ModShift != 0:
+		k = tcell.KeyBacktab
+	}
+	if k == tcell.KeyBacktab {
+		mods &^= tcell.ModShift
+	}
+	if k < ' ' || k == tcell.KeyBackspace {
+		mods &^= tcell.ModCtrl // Ctrl-A, or Backspace/Tab/Enter/Esc
+	}
+	name, ok := tcell.KeyNames[k]
+	if !ok {
+		name = fmt.Sprintf("Key%d", k)
+	}
+	return modPrefix(mods) + name
+}
+
+var KEY_ALIASES = map[string]string{
+	"space":    "Space",
+	"pgdown":   "PgDn",
+	"pagedown": "PgDn",
+	"pageup":   "PgUp",
+	"del":      "Delete",
+	"ins":      "Insert",
+	"bs":       "Backspace",
+	"return":   "Enter",
+	"escape":   "Esc",
+}
+
+var KEY_MODIFIERS = []struct {
+	name string
+	mod  tcell.ModMask
+}{
+	{"ctrl", tcell.ModCtrl},
+	{"c", tcell.ModCtrl},
+	{"alt", tcell.ModAlt},
+	{"meta", tcell.ModAlt},
+	{"a", tcell.ModAlt},
+	{"m", tcell.ModAlt},
+	{"shift", tcell.ModShift},
+	{"s", tcell.ModShift},
+}
+
+// canonical name of a key as returned by keyName(): "ctrl+x", "C-x", "M-1", "pgdown" are "Ctrl-X", "Ctrl-X", "Alt-1", "PgDn".
+// Single characters are case-sensitive
+func parseKeyName(s string) (string, error) {
+	ev, err := parseKey(s)
+	if err != nil {
+		return "", err
+	}
+	return keyName(ev), nil
+}
+
+// key event of a key name, see parseKeyName()
+func parseKey(s string) (*tcell.EventKey, error) {
+	var mods tcell.ModMask
+	rest := s
+	for found := true; found; {
+		found = false
+		for _, m := range KEY_MODIFIERS {
+			n := len(m.name)
+			if len(rest) > n+1 && strings.EqualFold(rest[:n], m.name) && (rest[n] == '-' || rest[n] == '+') {
+				mods |= m.mod
+				rest = rest[n+1:]
+				found = true
+				break
+			}
+		}
+	}
+
+	if r, size := utf8.DecodeRuneInString(rest); size == len(rest) && r != utf8.RuneError {
+		switch {
+		case mods&tcell.ModCtrl != 0:
+			c := unicode.ToLower(r)
+			if c < 'a' || c > 'z' {
+				return nil, fmt.Errorf("invalid key: %s, only Ctrl-A..Ctrl-Z", s)
+			}
+			return tcell.NewEventKey(tcell.KeyCtrlA+tcell.Key(c-'a'), 0, mods), nil
+		case r == ' ':
+			return tcell.NewEventKey(tcell.KeyRune, r, mods), nil
+		case mods&tcell.ModShift != 0:
+			r = unicode.ToUpper(r)
+		}
+		return tcell.NewEventKey(tcell.KeyRune, r, mods&^tcell.ModShift), nil
+	}
+
+	if name, ok := KEY_ALIASES[strings.ToLower(rest)]; ok {
+		rest = name
+	}
+	if rest == "Space" {
+		return tcell.NewEventKey(tcell.KeyRune, ' ', mods), nil
+	}
+	for k, name := range tcell.KeyNames {
+		if strings.EqualFold(name, rest) {
+			return tcell.NewEventKey(k, 0, mods), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid key: %s", s)
+}
+
+func bindingHelp(b string) string {
+	if i, ok := actionsByName[b]; ok {
+		return ACTIONS[i].help
+	}
+	return ""
+}
+
+// bindings sorted by key, then actions without keys
+func listKeys() []string {
+	keys := make([]string, 0, len(keyBindings))
+	bound := make(map[string]bool)
+	for k, b := range keyBindings {
+		keys = append(keys, k)
+		bound[b] = true
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0)
+	for _, k := range keys {
+		b := keyBindings[k]
+		lines = append(lines, fmt.Sprintf("%-14s %-22s %s", k, b, bindingHelp(b)))
+	}
+	for _, a := range ACTIONS {
+		if !bound[a.name] {
+			lines = append(lines, fmt.Sprintf("%-14s %-22s %s", "-", a.name, a.help))
+		}
+	}
+	return lines
+}
+
+// map [<key> <action> | <key> :<command>], "none" unbinds the key
+func cmd_map(args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		lines := listKeys()
+		panel := &ListPanel{
+			Title: "key bindings",
+			Len:   func() int { return len(lines) },
+			Line:  func(i int) string { return lines[i] },
+			Keys:  ":map <key> <action> or :map <key> :<command>  esc: close",
+		}
+		panel.Run(func(*tcell.EventKey, int) bool { return false })
+		return
+	}
+
+	a := strings.SplitN(args, " ", 2)
+	if len(a) < 2 {
+		showErrStr("map: need <key> <action or :command>")
+		return
+	}
+	key, err := parseKeyName(a[0])
+	if err != nil {
+		showError(err)
+		return
+	}
+	b := strings.TrimSpace(a[1])
+	if strings.HasPrefix(b, ":") {
+		if _, err := findCommand(strings.SplitN(b[1:], " ", 2)[0]); err != nil {
+			showError(err)
+			return
+		}
+	} else if _, ok := actionsByName[b]; !ok {
+		showErrStr("map: unknown action: ", b)
+		return
+	}
+	if b == "none" {
+		delete(keyBindings, key)
+		return
+	}
+	keyBindings[key] = b
+}
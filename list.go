@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// full-screen scrollable list, i.e. search results
+type ListPanel struct {
+	Title  string
+	Len    func() int
+	Line   func(i int) string
+	Status func() string // optional, shown in the bottom line
+	Keys   string        // key hints, shown in the bottom line
+
+	sel int
+	top int
+}
+
+// shows the list until an item is chosen with Enter or the panel is closed with Esc/q (returns -1).
+// Other keys are passed to onKey, Esc/q too: the panel is not closed if onKey returns true (key is handled)
+func (l *ListPanel) Run(onKey func(ev *tcell.EventKey, sel int) bool) int {
+	for {
+		l.draw()
+
+		switch ev := pollEvent().(type) {
+		case *tcell.EventResize:
+			scrWidth, scrHeight = ev.Size()
+			if !customColsMode {
+				calcDefaultCols(scrWidth)
+			}
+			screen.Sync()
+		case *macroCmdEvent:
+			stopMacroAtCmd(ev)
+		case *tcell.EventKey:
+			lastErrMsg, lastMsg = "", ""
+			n := l.Len()
+			page := scrHeight - 2
+			switch ev.Key() {
+			case tcell.KeyUp:
+				l.sel--
+			case tcell.KeyDown:
+				l.sel++
+			case tcell.KeyPgUp:
+				l.sel -= page
+			case tcell.KeyPgDn:
+				l.sel += page
+			case tcell.KeyHome:
+				l.sel = 0
+			case tcell.KeyEnd:
+				l.sel = n - 1
+			case tcell.KeyEnter:
+				if l.sel >= 0 && l.sel < n {
+					return l.sel
+				}
+				beep()
+			default:
+				handled := onKey != nil && onKey(ev, l.sel)
+				if !handled && (ev.Key() == tcell.KeyEsc || ev.Key() == tcell.KeyCtrlC || ev.Key() == tcell.KeyRune && (ev.Rune() == 'q' || ev.Rune() == 'Q')) {
+					return -1
+				}
+			}
+			if l.sel >= n {
+				l.sel = n - 1
+			}
+			if l.sel < 0 {
+				l.sel = 0
+			}
+		}
+	}
+}
+
+func (l *ListPanel) draw() {
+	screen.Clear()
+	page := scrHeight - 2
+	n := l.Len()
+	if l.sel < l.top {
+		l.top = l.sel
+	}
+	if l.sel >= l.top+page {
+		l.top = l.sel - page + 1
+	}
+	if l.top < 0 {
+		l.top = 0
+	}
+
+	title := l.Title
+	if n > 0 {
+		title += fmt.Sprintf("  [%d/%d]", l.sel+1, n)
+	}
+	printAtSt(0, 0, title, tcell.StyleDefault.Bold(true))
+
+	for y := 0; y < page && l.top+y < n; y++ {
+		i := l.top + y
+		st := tcell.StyleDefault
+		if i == l.sel {
+			st = st.Reverse(true)
+			printAtSt(0, y+1, fmt.Sprintf("%*s", -scrWidth, l.Line(i)), st)
+		} else {
+			printAtSt(0, y+1, l.Line(i), st)
+		}
+	}
+
+	status := l.Keys
+	if l.Status != nil {
+		status = l.Status() + "  " + status
+	}
+	if len(lastErrMsg) > 0 {
+		printAtSt(0, scrHeight-1, lastErrMsg, stErr)
+	} else if len(lastMsg) > 0 {
+		printAt(0, scrHeight-1, lastMsg)
+	} else {
+		printAtSt(0, scrHeight-1, status, stGray)
+	}
+	screen.Show()
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// macro registers a-z, 0-9
+const MACRO_REGISTERS = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+var (
+	macros      = make(map[string][]string) // register -> steps: key names or ":command"
+	macroRecReg string                      // register being recorded, "" if not recording
+	macroRec    []string
+	macroQueue  []*macroPlay // macros being played, innermost first
+	typeahead   []tcell.Event
+)
+
+const MAX_MACRO_DEPTH = 1000
+
+// playback of a macro, the count is not expanded so "999@a until it fails" is cheap
+type macroPlay struct {
+	reg   string
+	steps []string
+	count int64 // repeats left, including the current one
+	index int   // next step
+}
+
+// command from a macro, as an event for handleEvents()
+type macroCmdEvent struct {
+	tcell.EventTime
+	cmd string
+}
+
+// screen.PollEvent() replacement: plays the macro steps, records the keys
+func pollEvent() tcell.Event {
+	for len(macroQueue) > 0 {
+		// keys typed during the playback are kept for later, esc/ctrl+c stops it
+		for screen.HasPendingEvent() {
+			ev := screen.PollEvent()
+			if kev, ok := ev.(*tcell.EventKey); ok && (kev.Key() == tcell.KeyEsc || kev.Key() == tcell.KeyCtrlC) {
+				stopMacro("interrupted")
+				break
+			}
+			typeahead = append(typeahead, ev)
+		}
+		reg, step, ok := nextMacroStep()
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(step, ":") && len(step) > 1 {
+			ev := &macroCmdEvent{cmd: step[1:]}
+			ev.SetEventNow()
+			return ev
+		}
+		ev, err := parseKey(step)
+		if err != nil {
+			showErrStr("macro ", reg, ": ", err)
+			continue
+		}
+		return ev
+	}
+
+	var ev tcell.Event
+	if len(typeahead) > 0 {
+		ev, typeahead = typeahead[0], typeahead[1:]
+	} else {
+		ev = screen.PollEvent()
+	}
+	if kev, ok := ev.(*tcell.EventKey); ok && macroRecReg != "" {
+		macroRec = append(macroRec, keyName(kev))
+	}
+	return ev
+}
+
+// drops the finished playbacks
+func popFinishedMacros() {
+	for len(macroQueue) > 0 {
+		p := macroQueue[0]
+		if p.index == len(p.steps) {
+			p.index = 0
+			p.count--
+		}
+		if p.count > 0 {
+			return
+		}
+		macroQueue = macroQueue[1:]
+	}
+}
+
+func nextMacroStep() (reg, step string, ok bool) {
+	popFinishedMacros()
+	if len(macroQueue) == 0 {
+		return "", "", false
+	}
+	p := macroQueue[0]
+	p.index++
+	return p.reg, p.steps[p.index-1], true
+}
+
+// failed search, command error, etc: the rest of the macro is not played
+func stopMacro(reason string) {
+	if len(macroQueue) == 0 {
+		return
+	}
+	reg := macroQueue[0].reg
+	macroQueue = nil
+	if lastErrMsg == "" {
+		lastErrMsg = fmt.Sprintf("macro %s %s", reg, reason)
+	}
+}
+
+// a command step where a prompt or a panel waits for a key, the rest would run in the wrong place
+func stopMacroAtCmd(ev *macroCmdEvent) {
+	stopMacro("stopped: :" + ev.cmd + " while waiting for a key")
+}
+
+// plays the macro before the rest of the current one, if any, i.e. a macro may play another one
+func playMacro(reg string, count int64) {
+	steps := macros[reg]
+	if len(steps) == 0 {
+		showErrStr("macro ", reg, " is empty")
+		return
+	}
+	if count <= 0 {
+		showErrStr("macro: invalid count: ", count)
+		return
+	}
+	// a macro playing another one as its last step doesn't nest, i.e. a recursive macro is a loop
+	popFinishedMacros()
+	if len(macroQueue) >= MAX_MACRO_DEPTH {
+		showErrStr("macro: nested too deep")
+		return
+	}
+	macroQueue = append([]*macroPlay{{reg, steps, count, 0}}, macroQueue...)
+}
+
+// the key that started the recording, and the key that stopped it are not recorded
+func startRecording(reg string) {
+	macroRecReg, macroRec = reg, make([]string, 0)
+}
+
+func stopRecording() {
+	reg, steps := macroRecReg, macroRec
+	if len(steps) > 0 {
+		steps = steps[:len(steps)-1] // the key that stopped the recording
+	}
+	macroRecReg, macroRec = "", nil
+	if err := saveMacro(reg, steps); err != nil {
+		lastErrMsg = "[?] " + err.Error()
+		return
+	}
+	showMsg(fmt.Sprintf("macro %s: %d steps", reg, len(steps)))
+}
+
+// replaces the keys typed in the command prompt since mark with the command itself
+func recordCommand(mark int, cmd string) {
+	if macroRecReg == "" || mark < 0 || mark > len(macroRec) {
+		return
+	}
+	macroRec = macroRec[:mark]
+	if cmd != "" {
+		macroRec = append(macroRec, ":"+cmd)
+	}
+}
+
+// index of the last recorded key, i.e. the one invoking the command prompt
+func recordMark() int {
+	return len(macroRec) - 1
+}
+
+// single key: register name, or "" if cancelled
+func askRegister(prompt string) string {
+	printAt(0, maxLinesPerPage, fmt.Sprintf("%-*s", scrWidth, prompt))
+	screen.Show()
+	for {
+		switch ev := pollEvent().(type) {
+		case *macroCmdEvent:
+			stopMacroAtCmd(ev)
+		case *tcell.EventKey:
+			if ev.Key() == tcell.KeyRune && strings.ContainsRune(MACRO_REGISTERS, ev.Rune()) {
+				return string(ev.Rune())
+			}
+			if ev.Key() != tcell.KeyRune {
+				return ""
+			}
+			beep()
+		}
+	}
+}
+
+func macroRecordKey() {
+	if macroRecReg != "" {
+		stopRecording()
+		return
+	}
+	if reg := askRegister("record macro [a-z0-9]: "); reg != "" {
+		startRecording(reg)
+	}
+}
+
+func macroPlayKey() {
+	if reg := askRegister("play macro [a-z0-9]: "); reg != "" {
+		playMacro(reg, 1)
+	}
+}
+
+func macrosFileName() string {
+	path, err := getAppDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(path, "macros.json")
+}
+
+func loadMacros() (map[string][]string, error) {
+	m := make(map[string][]string)
+	fname := macrosFileName()
+	if fname == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return m, nil
+}
+
+func initMacros() {
+	m, err := loadMacros()
+	if err != nil {
+		lastErrMsg = "[?] " + err.Error()
+		return
+	}
+	macros = m
+}
+
+// sets or deletes (no steps) the macro, merged with the ones saved by other instances
+func saveMacro(reg string, steps []string) error {
+	fname := macrosFileName()
+	if fname == "" {
+		return errors.New("no app dir")
+	}
+	m, err := loadMacros()
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		delete(m, reg)
+	} else {
+		m[reg] = steps
+	}
+	macros = m
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, data, 0600)
+}
+
+func macroRegs() []string {
+	regs := make([]string, 0, len(macros))
+	for reg := range macros {
+		regs = append(regs, reg)
+	}
+	sort.Strings(regs)
+	return regs
+}
+
+// macro [<register> [count]], lists the macros without arguments
+func cmd_macro(args string) {
+	a := strings.Fields(args)
+	if len(a) == 0 {
+		regs := macroRegs()
+		panel := &ListPanel{
+			Title: "macros",
+			Len:   func() int { return len(regs) },
+			Line:  func(i int) string { return regs[i] + "  " + strings.Join(macros[regs[i]], " ") },
+			Keys:  "enter: play  d: delete  esc: close",
+		}
+		sel := panel.Run(func(ev *tcell.EventKey, sel int) bool {
+			if ev.Key() == tcell.KeyRune && ev.Rune() == 'd' && sel >= 0 && sel < len(regs) {
+				if err := saveMacro(regs[sel], nil); err != nil {
+					showError(err)
+				}
+				regs = macroRegs()
+				return true
+			}
+			return false
+		})
+		if sel >= 0 && sel < len(regs) {
+			playMacro(regs[sel], 1)
+		}
+		return
+	}
+
+	reg := strings.ToLower(a[0])
+	if len(reg) != 1 || !strings.Contains(MACRO_REGISTERS, reg) {
+		showErrStr("macro: invalid register: ", a[0])
+		return
+	}
+	count := int64(1)
+	if len(a) > 1 {
+		var err error
+		if count, err = parseExprRadix(strings.Join(a[1:], " "), 10); err != nil {
+			showError(err)
+			return
+		}
+	}
+	playMacro(reg, count)
+}
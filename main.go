@@ -34,6 +34,7 @@ type Range struct {
 
 type Breadcrumb struct {
 	offset int64
+	cursor int64
 	key    tcell.Key
 }
 
@@ -54,12 +55,15 @@ var (
 	base            int64 = 0
 	baseMult        int64 = 1
 	offset          int64
+	cursor          int64 // current byte, independent of the page origin
 	offsetWidth     int
 	maxLinesPerPage int
 	nextOffset      int64
 	skipMap         map[Range]bool = make(map[Range]bool)
 	fname           string
 	allowWrite      bool = false
+	explicitOffset  bool = false // offset was given on the command line
+	offsetArg       string
 
 	sparseMap []Range = make([]Range, 0)
 	mapReady  bool    = false
@@ -70,16 +74,21 @@ var (
 	z = 0x31
 )
 
+// sparse map is in original file offsets, holes are skipped only within a piece of the original file
 func findNextData(pos int64) int64 {
 	if !mapReady {
 		return -1
 	}
+	fpos, _, pieceEnd := doc.origOffset(pos)
+	if fpos == -1 {
+		return -1
+	}
 
 	for _, r := range sparseMap {
-		if pos >= r.start && pos < r.end {
-			return r.end
+		if fpos >= r.start && fpos < r.end {
+			return min64(pos+r.end-fpos, pieceEnd)
 		}
-		if r.start > pos {
+		if r.start > fpos {
 			break
 		}
 	}
@@ -87,16 +96,20 @@ func findNextData(pos int64) int64 {
 }
 
 func findPrevData(pos int64) int64 {
-	if !mapReady {
+	if !mapReady || pos <= 0 {
+		return -1
+	}
+	fpos, pieceStart, _ := doc.origOffset(pos - 1)
+	if fpos == -1 {
 		return -1
 	}
 
 	for i := len(sparseMap) - 1; i >= 0; i-- {
 		r := sparseMap[i]
-		if pos > r.start && pos <= r.end {
-			return r.start
+		if fpos >= r.start && fpos < r.end {
+			return max64(pos-1-(fpos-r.start), pieceStart)
 		}
-		if r.end < pos {
+		if r.end <= fpos {
 			break
 		}
 	}
@@ -112,12 +125,26 @@ func toHexChar(c byte) byte {
 	}
 }
 
-func drawBin(x, y int, buf []byte, chars []rune, max_width int) int {
+// is the element starting at pos under the cursor?
+func isCursorElement(pos int64) bool {
+	return cursor >= pos && cursor < pos+int64(elWidth)
+}
+
+// adds the selection background if the byte at pos is selected
+func selStyle(st tcell.Style, pos int64) tcell.Style {
+	if isSelected(pos) {
+		return st.Background(colSelection)
+	}
+	return st
+}
+
+func drawBin(x, y int, buf []byte, pos int64, chars []rune, max_width int) int {
 	for j := 0; j < len(buf); j += elWidth {
 		if elWidth == 1 && j > 0 && j%(8*elWidth) == 0 { // Add an extra space every 8 groups
 			x++
 		}
 
+		atCursor := isCursorElement(pos + int64(j))
 		leadingZero := true
 		for k := elWidth - 1; k >= 0; k-- {
 			if j+k >= len(buf) {
@@ -125,13 +152,16 @@ func drawBin(x, y int, buf []byte, chars []rune, max_width int) int {
 			}
 			mask := byte(0x80)
 			byte := buf[j+k]
+			modified := doc.IsModified(pos + int64(j+k))
 
 			for i := 0; i < 8; i++ {
 				st := tcell.StyleDefault
 				bit := byte & mask
 				rune := chars[0]
 
-				if bit == 0 {
+				if modified {
+					st = stModified
+				} else if bit == 0 {
 					if leadingZero {
 						st = stGray
 					}
@@ -139,8 +169,11 @@ func drawBin(x, y int, buf []byte, chars []rune, max_width int) int {
 					//leadingZero = false
 					rune = chars[1]
 				}
+				if atCursor {
+					st = st.Reverse(true)
+				}
 
-				screen.SetCell(x, y, st, rune)
+				screen.SetCell(x, y, selStyle(st, pos+int64(j+k)), rune)
 				x++
 				mask >>= 1
 			}
@@ -153,13 +186,14 @@ func drawBin(x, y int, buf []byte, chars []rune, max_width int) int {
 	return x
 }
 
-func drawHex(x, y int, buf []byte, max_width int) int {
+func drawHex(x, y int, buf []byte, pos int64, max_width int) int {
 
 	for j := 0; j < len(buf); j += elWidth {
 		if elWidth == 1 && j > 0 && j%(8*elWidth) == 0 { // Add an extra space every 8 groups
 			x++
 		}
 
+		atCursor := isCursorElement(pos + int64(j))
 		leadingZero := elWidth > 1 || buf[j] == 0
 
 		for k := elWidth - 1; k >= 0; k-- {
@@ -169,32 +203,45 @@ func drawHex(x, y int, buf []byte, max_width int) int {
 			st0 := tcell.StyleDefault
 
 			byte := buf[j+k]
-			if elWidth == 1 && altColorMode && byte < 0x10 {
+			modified := doc.IsModified(pos + int64(j+k))
+			if modified {
+				st0 = stModified
+			} else if elWidth == 1 && altColorMode && byte < 0x10 {
 				st0 = stGray
 			}
+			if atCursor {
+				st0 = st0.Reverse(true)
+			}
+
+			// in edit mode the nibble being typed is underlined
+			editing := editMode && editColumn == EditColHex && pos+int64(j+k) == cursor
 
 			octet := byte >> 4
 			st := st0
 			if leadingZero {
 				if octet == 0 {
-					st = stGray
+					if !modified {
+						st = stGray.Reverse(atCursor)
+					}
 				} else {
 					leadingZero = false
 				}
 			}
-			screen.SetCell(x, y, st, rune(toHexChar(octet)))
+			screen.SetCell(x, y, selStyle(st, pos+int64(j+k)).Underline(editing && editNibble == 0), rune(toHexChar(octet)))
 			x++
 
 			octet = byte & 0x0f
 			st = st0
 			if leadingZero {
 				if octet == 0 {
-					st = stGray
+					if !modified {
+						st = stGray.Reverse(atCursor)
+					}
 				} else {
 					leadingZero = false
 				}
 			}
-			screen.SetCell(x, y, st, rune(toHexChar(octet)))
+			screen.SetCell(x, y, selStyle(st, pos+int64(j+k)).Underline(editing && editNibble == 1), rune(toHexChar(octet)))
 			x++
 		}
 		x++
@@ -211,23 +258,42 @@ func drawLine(iLine int, chunk []byte, offset int64) int {
 
 // as in IDA's idc.here()
 func here() int64 {
-	return offset2ea(offset)
+	return offset2ea(cursor)
 }
 
+// mapped address if the offset is in the address map, base + offset*baseMult otherwise
 func offset2ea(offset int64) int64 {
+	if ea, ok := mapOffset(offset); ok {
+		return ea
+	}
 	return base + offset*baseMult
 }
 
+// addresses in the address map are virtual, the rest are in the file space
+func ea2offset(ea int64) int64 {
+	if off, ok := mapAddr(ea); ok {
+		return off
+	}
+	if baseMult == 0 {
+		return ea - base
+	}
+	return (ea - base) / baseMult
+}
+
 // also used for calculating max width
 func drawLine2(iLine int, chunk []byte, offset int64, max_width int) int {
-	printAt(0, iLine, fmt.Sprintf("%0*X:", offsetWidth, offset2ea(offset)))
+	if _, mapped := mapOffset(offset); mapped || len(addrMap) == 0 {
+		printAt(0, iLine, fmt.Sprintf("%0*X:", offsetWidth, offset2ea(offset)))
+	} else {
+		printAtSt(0, iLine, fmt.Sprintf("%0*X~", offsetWidth, offset2ea(offset)), stUnmapped) // gap in the address map
+	}
 	x := offsetWidth + 2
 
 	if showBin {
 		if binMode01 {
-			x = drawBin(x, iLine, chunk, []rune{'0', '1'}, max_width) + 1
+			x = drawBin(x, iLine, chunk, offset, []rune{'0', '1'}, max_width) + 1
 		} else {
-			x = drawBin(x, iLine, chunk, []rune{'_', 'X'}, max_width) + 1
+			x = drawBin(x, iLine, chunk, offset, []rune{'_', 'X'}, max_width) + 1
 		}
 
 		if x >= max_width {
@@ -236,12 +302,23 @@ func drawLine2(iLine int, chunk []byte, offset int64, max_width int) int {
 	}
 
 	if showHex {
-		x = drawHex(x, iLine, chunk, max_width) + 1
+		x = drawHex(x, iLine, chunk, offset, max_width) + 1
 		if x >= max_width {
 			return x
 		}
 	}
 
+	// symbol label in the gap before the right-aligned ASCII column, not counted in the width
+	if s, ok := symbolAt(offset, int64(len(chunk))); ok && showASCII && !showUnicode && cols < int64(max_width) && (showBin || showHex) {
+		if room := max_width - int(cols) - 1 - x; room >= MIN_LABEL_WIDTH {
+			label := s.Name
+			if len(label) > room {
+				label = label[:room-1] + "~"
+			}
+			printAtSt(x, iLine, label, stLabel)
+		}
+	}
+
 	if showUnicode {
 		var s string
 		if unicodeMode {
@@ -254,14 +331,14 @@ func drawLine2(iLine int, chunk []byte, offset int64, max_width int) int {
 		if stickToRight {
 			start_x = max_width - int(cols)/2
 		}
-		x += printAt(start_x, iLine, s) + 1
+		x += printAtUTF16(start_x, iLine, s, offset) + 1
 	}
 
 	if showASCII {
 		if cols < int64(max_width) && (showBin || showHex) {
-			printAtBytes(max_width-int(cols), iLine, chunk)
+			printAtBytes(max_width-int(cols), iLine, chunk, offset)
 		} else {
-			printAtBytes(x, iLine, chunk)
+			printAtBytes(x, iLine, chunk, offset)
 		}
 		x += len(chunk) + 1
 	}
@@ -487,9 +564,84 @@ func lastPageOffset() int64 {
 	return max64(0, fileSize-fileSize%cols-int64(maxLinesPerPage-1)*cols+add)
 }
 
+func pushBreadcrumb(key tcell.Key) {
+	breadcrumbs = append(breadcrumbs, Breadcrumb{offset, cursor, key})
+}
+
+func popBreadcrumb() {
+	if len(breadcrumbs) > 0 {
+		offset = breadcrumbs[len(breadcrumbs)-1].offset
+		cursor = breadcrumbs[len(breadcrumbs)-1].cursor
+		breadcrumbs = breadcrumbs[:len(breadcrumbs)-1]
+	}
+}
+
 func gotoOffset(new_offset int64) {
-	breadcrumbs = append(breadcrumbs, Breadcrumb{offset, -1})
-	offset = (new_offset - base) / baseMult
+	pushBreadcrumb(-1)
+	setCursor(ea2offset(new_offset))
+}
+
+// scrolls the page, cursor keeps its place on the screen
+func scrollPage(delta int64) {
+	offset += delta
+	cursor += delta
+}
+
+// moves cursor to pos; if pos is not on the current page then the page starts at pos
+func setCursor(pos int64) {
+	if pos < offset || pos >= nextOffset {
+		offset = pos
+	}
+	cursor = pos
+}
+
+func clampCursor() {
+	if editMode && editInsert {
+		// allow appending at the end
+		if cursor > fileSize {
+			cursor = fileSize
+		}
+	} else if cursor >= fileSize {
+		cursor = fileSize - 1
+	}
+	if cursor < 0 {
+		cursor = 0
+	}
+}
+
+// scrolls the page by whole lines until cursor is on it, returns true if the page was moved
+func scrollToCursor() bool {
+	if cursor < offset {
+		offset -= cols * ((offset - cursor + cols - 1) / cols)
+		if offset < 0 {
+			offset = 0
+		}
+		return true
+	}
+	if cursor >= nextOffset && nextOffset < fileSize {
+		offset += cols * ((cursor-nextOffset)/cols + 1)
+		skipDedupRegion(&offset, 1)
+		return true
+	}
+	return false
+}
+
+// moves pos out of the hidden duplicate lines, keeping its column
+func skipDedupRegion(pos *int64, dir int) {
+	if !g_dedup || dir == 0 {
+		return
+	}
+	for k := range skipMap {
+		if *pos >= k.start && *pos < k.end {
+			col := (*pos - k.start) % cols
+			if dir == 1 {
+				*pos = k.end + col
+			} else {
+				*pos = k.start - cols + col
+			}
+			break
+		}
+	}
 }
 
 func writeFile(fname string, offset int64, size int64) error {
@@ -525,11 +677,12 @@ func writeFile(fname string, offset int64, size int64) error {
 }
 
 func setBookmark(n int) {
-	bookmarks[n] = offset
+	bookmarks[n] = cursor
 }
 
 func gotoBookmark(n int) {
-	offset = bookmarks[n]
+	pushBreadcrumb(-1)
+	setCursor(bookmarks[n])
 }
 
 func printLastErr() {
@@ -563,38 +716,91 @@ func getAppDir() (string, error) {
 	return filepath.Join(configDir, "h"), nil
 }
 
+// document was modified
+func docChanged() {
+	fileSize = doc.Size()
+	invalidateSkips()
+	remapSymbols()
+}
+
+// writes data to the file as is, without journaling
+// returns the number of bytes written, also on an error
+func writeAt(offset int64, data []byte) (int, error) {
+	f, err := os.OpenFile(fname, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.WriteAt(data, offset)
+}
+
 func patchFile(offset, size int64, data []byte) {
+	size0 := size
 	if offset < 0 || offset+size > fileSize || len(data) == 0 {
 		showErrStr("patchFile: Invalid arguments")
 		return
 	}
 
 	if !allowWrite {
-		showErrStr("Writing is not allowed (hint: use -w option or ':set allowWrite=1')")
+		showErrStr(ERR_WRITE_NOT_ALLOWED)
+		return
+	}
+
+	if !doc.IsIdentity() {
+		showError(errNotIdentity)
+		return
+	}
+
+	var chunks []UndoChunk
+	if size <= MAX_UNDO_CHUNK_SIZE {
+		old, err := readOriginal(offset, size)
+		if err != nil {
+			showError(err)
+			return
+		}
+		chunks = []UndoChunk{{offset, old, bytes.Repeat(data, int(size)/len(data)+1)[:size]}}
+		undoJournal.RecordDisk(chunks)
+	} else if !confirm(fmt.Sprintf("0x%x bytes are too many to undo, write anyway? (y/n) ", size)) {
 		return
 	}
 
+	written := int64(0)
+	failed := func(err error) {
+		if chunks != nil {
+			undoJournal.KeepWritten(chunks, 0, written)
+		}
+		if written > 0 {
+			doc.Revert(offset, written)
+		}
+		showError(err)
+	}
+
 	f, err := os.OpenFile(fname, os.O_RDWR, 0644)
 	if err != nil {
-		showError(err)
+		failed(err)
 		return
 	}
 	defer f.Close()
 
-	f.Seek(offset, 0)
+	if _, err := f.Seek(offset, 0); err != nil {
+		failed(err)
+		return
+	}
 	for size > 0 {
 		n := min32(int(size), len(data))
 		nWritten, err := f.Write(data[0:n])
-		if err != nil {
-			showError(err)
-			return
+		written += int64(nWritten)
+		if err == nil && nWritten != n {
+			err = io.ErrShortWrite
 		}
-		if nWritten != n {
-			showErrStr("patchFile: short write", nWritten, "of", n)
+		if err != nil {
+			failed(err)
 			return
 		}
 		size -= int64(len(data))
 	}
+	doc.Revert(offset, size0)
 }
 
 func main() {
@@ -613,6 +819,11 @@ func main() {
 	}
 	defer file.Close()
 
+	fileInfo, err := file.Stat()
+	if err != nil {
+		panic(err)
+	}
+
 	align := 0
 	reader = file
 	if isBlockDevice(fname) {
@@ -625,17 +836,19 @@ func main() {
 			reader = NewAlignedReader(file, fileSize, align)
 		}
 	} else {
-		fileInfo, err := file.Stat()
-		if err != nil {
-			panic(err)
-		}
 		fileSize = fileInfo.Size()
 	}
+	doc = NewDocument(reader, fileSize)
+	reader = doc
+	if !isBlockDevice(fname) {
+		loadSymbols(reader)
+	}
 
 	if g_debug {
 		fmt.Println("[d] size:", fileSize)
 		fmt.Println("[d] isBlockDevice:", isBlockDevice(fname))
 		fmt.Println("[d] align:", align)
+		fmt.Println("[d] symbols:", len(symbols), symbolsFormat)
 		buildSparseMap()
 		if len(sparseMap) > 0 {
 			fmt.Println("[d] sparse map:")
@@ -646,13 +859,27 @@ func main() {
 		os.Exit(0)
 	}
 
-	go initSearchHistory()
-	go initCommandHistory()
+	initMacros()
+
+	initSession(fname, fileInfo)
+	defer saveSession()
+	initUndoJournal()
 
-	offsetWidth = len(fmt.Sprintf("%X", fileSize))
-	if offsetWidth < 8 {
-		offsetWidth = 8
+	if addrMapFlag != "" {
+		if err := loadAddrMap(addrMapFlag); err != nil {
+			fmt.Println("Error loading address map:", err)
+			os.Exit(1)
+		}
+	}
+	if offsetArg != "" {
+		ea, err := parseExprRadix(offsetArg, 16)
+		if err != nil {
+			fmt.Println("Error parsing offset:", err)
+			os.Exit(1)
+		}
+		gotoOffset(ea)
 	}
+	calcOffsetWidth()
 
 	defer printLastErr()
 
@@ -665,8 +892,12 @@ func main() {
 	}
 	defer screen.Fini()
 
+	// lastErrMsg is only set by the main goroutine, run_cmd_err() checks it
+	go func() { postError("search history: ", initSearchHistory()) }()
+	go func() { postError("command history: ", initCommandHistory()) }()
 	go buildSparseMap()
 
+	runStartupScripts()
 	draw()
 	handleEvents()
 }
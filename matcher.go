@@ -0,0 +1,663 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	SearchModeHex = iota
+	SearchModeText
+	SearchModeRegex
+	SearchModeHexMask // hex with wildcards, not selectable by Tab: entered in hex mode, pattern is the source text
+	SearchModeMulti   // list of patterns, any of them matches
+	SearchModeNumber  // integer or float value, or a range of them
+
+	SearchModeMax = SearchModeNumber
+)
+
+// text search options
+const (
+	TextIgnoreCase = 1 << iota // ASCII letters only
+	TextUTF16LE
+	TextUTF16BE
+	TextUTF8 // plain text along with UTF-16, plain text is the default if no UTF-16 flag is set
+)
+
+// encodings switched by Ctrl-T in the text search prompt
+var TEXT_ENCODINGS = []int{0, TextUTF16LE, TextUTF16BE, TextUTF16LE | TextUTF16BE, TextUTF8 | TextUTF16LE | TextUTF16BE}
+
+const MAX_REGEX_MATCH = 64 * 1024 // longer regex matches are not guaranteed to be found across chunk boundaries
+
+// Matcher finds pattern occurrences in a chunk of data
+type Matcher interface {
+	// first match in buf: start and length, start is -1 if there is no match
+	Index(buf []byte) (int, int)
+	// last match in buf starting before limit
+	LastIndex(buf []byte, limit int) (int, int)
+	// max length of a match, used as overlap between chunks
+	MaxLen() int
+}
+
+// Matcher with several patterns, tells which one was matched last
+type matchDescriber interface {
+	DescribeMatch(buf []byte) string // pattern matching at the start of buf
+}
+
+// matches only at offsets that are multiples of align
+type alignedMatcher struct {
+	Matcher
+	align int
+}
+
+func (m alignedMatcher) Align() int {
+	return m.align
+}
+
+// Matcher restricted to aligned offsets, the scan skips the other matches
+type matchAligner interface {
+	Align() int
+}
+
+func matchAlign(m Matcher) int64 {
+	if a, ok := m.(matchAligner); ok {
+		return int64(a.Align())
+	}
+	return 1
+}
+
+// shows which pattern matched at pos, if the matcher has several
+func showMatch(m Matcher, pos int64) {
+	if d, ok := m.(matchDescriber); ok {
+		buf := make([]byte, m.MaxLen())
+		n, _ := reader.ReadAt(buf, pos)
+		showMsg("found " + d.DescribeMatch(buf[:n]))
+	}
+}
+
+func newMatcher(mode, flags int, pattern []byte) (Matcher, error) {
+	switch mode {
+	case SearchModeRegex:
+		return newRegexMatcher(string(pattern))
+	case SearchModeHexMask:
+		return newMaskMatcher(string(pattern))
+	case SearchModeMulti:
+		return newAhoMatcher(string(pattern))
+	case SearchModeText:
+		return newTextMatcher(pattern, flags), nil
+	case SearchModeNumber:
+		return newNumberMatcher(string(pattern), flags)
+	default:
+		return bytesMatcher(pattern), nil
+	}
+}
+
+// short description of text options, i.e. "i,le,be"
+func textFlagsString(flags int) string {
+	a := make([]string, 0)
+	if flags&TextIgnoreCase != 0 {
+		a = append(a, "i")
+	}
+	if flags&TextUTF8 != 0 {
+		a = append(a, "utf8")
+	}
+	if flags&TextUTF16LE != 0 {
+		a = append(a, "le")
+	}
+	if flags&TextUTF16BE != 0 {
+		a = append(a, "be")
+	}
+	return strings.Join(a, ",")
+}
+
+// text in each of the selected encodings
+func newTextMatcher(text []byte, flags int) Matcher {
+	units := utf16.Encode([]rune(string(text)))
+	pats := make([][]maskedByte, 0)
+	if flags&(TextUTF16LE|TextUTF16BE) == 0 || flags&TextUTF8 != 0 {
+		pat := make([]maskedByte, len(text))
+		for i, c := range text {
+			pat[i] = textByte(c, flags)
+		}
+		pats = append(pats, pat)
+	}
+	for _, enc := range []int{TextUTF16LE, TextUTF16BE} {
+		if flags&enc == 0 {
+			continue
+		}
+		pat := make([]maskedByte, 0, len(units)*2)
+		for _, u := range units {
+			lo, hi := maskedByte{0xff, byte(u), byte(u)}, maskedByte{0xff, byte(u >> 8), byte(u >> 8)}
+			if u < 0x80 {
+				lo = textByte(byte(u), flags)
+			}
+			if enc == TextUTF16LE {
+				pat = append(pat, lo, hi)
+			} else {
+				pat = append(pat, hi, lo)
+			}
+		}
+		pats = append(pats, pat)
+	}
+
+	if flags&TextIgnoreCase == 0 && len(pats) == 1 && flags&(TextUTF16LE|TextUTF16BE) == 0 {
+		return bytesMatcher(text)
+	}
+	ms := make(anyMatcher, len(pats))
+	for i, pat := range pats {
+		ms[i] = newMaskMatcherPat(pat)
+	}
+	if len(ms) == 1 {
+		return ms[0]
+	}
+	return ms
+}
+
+// ASCII letters differ only in bit 5
+func textByte(c byte, flags int) maskedByte {
+	if flags&TextIgnoreCase != 0 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		c &= 0xdf
+		return maskedByte{0xdf, c, c}
+	}
+	return maskedByte{0xff, c, c}
+}
+
+// matches any of the patterns
+type anyMatcher []Matcher
+
+func (ms anyMatcher) Index(buf []byte) (int, int) {
+	best, bestLen := -1, 0
+	for _, m := range ms {
+		end := len(buf)
+		if best != -1 {
+			end = min32(best+m.MaxLen(), len(buf)) // only matches starting before the best one are of interest
+		}
+		if i, n := m.Index(buf[:end]); i != -1 && (best == -1 || i < best) {
+			best, bestLen = i, n
+		}
+	}
+	return best, bestLen
+}
+
+func (ms anyMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	best, bestLen := -1, 0
+	for _, m := range ms {
+		if i, n := m.LastIndex(buf, limit); i > best {
+			best, bestLen = i, n
+		}
+	}
+	return best, bestLen
+}
+
+func (ms anyMatcher) MaxLen() int {
+	max := 0
+	for _, m := range ms {
+		if n := m.MaxLen(); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// exact byte sequence
+type bytesMatcher []byte
+
+func (m bytesMatcher) Index(buf []byte) (int, int) {
+	return bytes.Index(buf, m), len(m)
+}
+
+func (m bytesMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	if end := limit + len(m) - 1; end < len(buf) {
+		buf = buf[:end]
+	}
+	return bytes.LastIndex(buf, m), len(m)
+}
+
+func (m bytesMatcher) MaxLen() int {
+	return len(m)
+}
+
+// bytes 80..ff are matched as the private use runes F780..F7FF, which have no case folding, so (?i) folds only ASCII
+const REGEX_HIGH_BYTES = 0xF700
+
+// Go regexp matched against raw bytes, \xNN matches byte NN
+type regexMatcher struct {
+	re       *regexp.Regexp
+	anchored *regexp.Regexp // re matching only at the start, tried where the prefix is found
+	prefix   []byte         // literal prefix of all the matches
+	complete bool           // the prefix is the whole pattern
+	ascii    bool           // matches only ASCII bytes, so buf is searched directly
+	maxLen   int
+}
+
+func newRegexMatcher(expr string) (*regexMatcher, error) {
+	expr = mapRegexBytes(expr)
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	anchored, err := regexp.Compile(`^(?:` + expr + `)`)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	maxLen := regexMaxLen(tree.Simplify())
+	if maxLen < 0 || maxLen > MAX_REGEX_MATCH {
+		maxLen = MAX_REGEX_MATCH
+	}
+	if maxLen < 1 {
+		maxLen = 1
+	}
+
+	m := &regexMatcher{re: re, anchored: anchored, ascii: !regexMatchesHigh(tree), maxLen: maxLen}
+	prefix, complete := re.LiteralPrefix()
+	m.complete = complete
+	for _, r := range prefix {
+		switch {
+		case r < utf8.RuneSelf:
+			m.prefix = append(m.prefix, byte(r))
+		case r >= REGEX_HIGH_BYTES+0x80 && r <= REGEX_HIGH_BYTES+0xff:
+			m.prefix = append(m.prefix, byte(r-REGEX_HIGH_BYTES))
+		default: // never matches a byte, the rest of the prefix is not used
+			m.complete = false
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+// pattern with the bytes 80..ff replaced by their private use runes: \xNN, \x{NN} and octal escapes, latin-1 characters
+func mapRegexBytes(expr string) string {
+	var b strings.Builder
+	quoted := false // in \Q...\E
+	for i := 0; i < len(expr); {
+		switch {
+		case quoted && strings.HasPrefix(expr[i:], `\E`):
+			quoted = false
+			i += 2
+		case !quoted && expr[i] == '\\' && i+1 < len(expr):
+			if n, v := regexEscape(expr[i:]); n > 0 {
+				if v >= utf8.RuneSelf && v <= 0xff {
+					fmt.Fprintf(&b, `\x{%X}`, REGEX_HIGH_BYTES+v)
+				} else {
+					b.WriteString(expr[i : i+n])
+				}
+				i += n
+			} else if expr[i+1] == 'Q' {
+				quoted = true
+				i += 2
+			} else {
+				_, n := utf8.DecodeRuneInString(expr[i+1:])
+				b.WriteString(expr[i : i+1+n])
+				i += 1 + n
+			}
+		default:
+			r, n := utf8.DecodeRuneInString(expr[i:])
+			switch {
+			case r >= utf8.RuneSelf && r <= 0xff:
+				fmt.Fprintf(&b, `\x{%X}`, REGEX_HIGH_BYTES+r)
+			case quoted:
+				b.WriteString(regexp.QuoteMeta(expr[i : i+n]))
+			default:
+				b.WriteString(expr[i : i+n])
+			}
+			i += n
+		}
+	}
+	return b.String()
+}
+
+// length and value of the \xNN, \x{N...} or octal escape at the start of s, 0 for other escapes
+func regexEscape(s string) (int, rune) {
+	switch {
+	case s[1] == 'x' && len(s) > 2 && s[2] == '{':
+		end := strings.IndexByte(s, '}')
+		if end == -1 {
+			return 0, 0
+		}
+		v, err := strconv.ParseUint(s[3:end], 16, 32)
+		if err != nil {
+			return 0, 0
+		}
+		return end + 1, rune(v)
+	case s[1] == 'x' && len(s) >= 4:
+		v, err := strconv.ParseUint(s[2:4], 16, 8)
+		if err != nil {
+			return 0, 0
+		}
+		return 4, rune(v)
+	case s[1] >= '0' && s[1] <= '7':
+		n := 2
+		for n < len(s) && n < 4 && s[n] >= '0' && s[n] <= '7' {
+			n++
+		}
+		if s[1] != '0' && n == 2 {
+			return 0, 0 // a backreference, rejected by the regexp
+		}
+		v, _ := strconv.ParseUint(s[1:n], 8, 32)
+		return n, rune(v)
+	}
+	return 0, 0
+}
+
+// whether the regexp can match bytes 80..ff, or the UTF-8 of a non-ASCII case folding of an ASCII letter
+func regexMatchesHigh(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r >= utf8.RuneSelf {
+				return true
+			}
+			for f := unicode.SimpleFold(r); re.Flags&syntax.FoldCase != 0 && f != r; f = unicode.SimpleFold(f) {
+				if f >= utf8.RuneSelf {
+					return true
+				}
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 1; i < len(re.Rune); i += 2 {
+			if re.Rune[i] >= utf8.RuneSelf {
+				return true
+			}
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	}
+	for _, sub := range re.Sub {
+		if regexMatchesHigh(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// max match length in bytes, -1 if unbounded
+func regexMaxLen(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpQuest:
+		return regexMaxLen(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		return -1
+	case syntax.OpRepeat:
+		n := regexMaxLen(re.Sub[0])
+		if re.Max < 0 || n < 0 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			n := regexMaxLen(sub)
+			if n < 0 {
+				return -1
+			}
+			total += n
+		}
+		return total
+	case syntax.OpAlternate:
+		max := 0
+		for _, sub := range re.Sub {
+			n := regexMaxLen(sub)
+			if n < 0 {
+				return -1
+			}
+			if n > max {
+				max = n
+			}
+		}
+		return max
+	}
+	return 0 // empty-width assertions
+}
+
+// feeds bytes to the regexp as runes, 80..ff as their private use runes
+type byteRuneReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *byteRuneReader) ReadRune() (rune, int, error) {
+	if r.pos >= len(r.buf) {
+		return 0, 0, io.EOF
+	}
+	c := r.buf[r.pos]
+	r.pos++
+	if c >= utf8.RuneSelf {
+		return REGEX_HIGH_BYTES + rune(c), 1, nil
+	}
+	return rune(c), 1, nil
+}
+
+func (m *regexMatcher) Index(buf []byte) (int, int) {
+	var loc []int
+	switch {
+	case m.ascii:
+		loc = m.re.FindIndex(buf)
+	case len(m.prefix) == 0:
+		loc = m.re.FindReaderIndex(&byteRuneReader{buf: buf})
+	default:
+		// the regexp is only run where the prefix is found
+		for pos := 0; loc == nil; pos++ {
+			i := bytes.Index(buf[pos:], m.prefix)
+			if i == -1 {
+				return -1, 0
+			}
+			pos += i
+			if m.complete {
+				return pos, len(m.prefix)
+			}
+			if loc = m.anchored.FindReaderIndex(&byteRuneReader{buf: buf, pos: pos}); loc != nil {
+				loc[0], loc[1] = pos, pos+loc[1] // offsets are relative to pos
+			}
+		}
+	}
+	if loc == nil {
+		return -1, 0
+	}
+	return loc[0], loc[1] - loc[0]
+}
+
+// searches windows of growing size back from the limit, the matches in a window until the last one
+func (m *regexMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	size := 4096
+	for hi := min32(limit, len(buf)); hi > 0; size *= 2 {
+		lo := max32(hi-size, 0)
+		end := min32(hi+m.maxLen, len(buf)) // matches starting before hi
+		last, lastLen := -1, 0
+		for pos := lo; pos < hi; {
+			i, n := m.Index(buf[pos:end])
+			if i == -1 || pos+i >= hi {
+				break
+			}
+			last, lastLen = pos+i, n
+			pos = last + 1
+		}
+		if last != -1 {
+			return last, lastLen
+		}
+		hi = lo
+	}
+	return -1, 0
+}
+
+func (m *regexMatcher) MaxLen() int {
+	return m.maxLen
+}
+
+// one byte of a masked pattern: matches b if lo <= b&mask <= hi
+type maskedByte struct {
+	mask, lo, hi byte
+}
+
+// hex pattern with wildcards: "48 8b ?? ?? 00 00", "4? 8b", "[a0-af] 00"
+type maskMatcher struct {
+	pat       []maskedByte
+	anchor    []byte // longest run of exact bytes, to quickly find candidates
+	anchorOff int
+}
+
+func isHexMask(s string) bool {
+	return strings.ContainsAny(s, "?[")
+}
+
+func parseHexByte(s string) (byte, error) {
+	if len(s) != 2 || !strings.Contains(HEX_CHARS, s[:1]) || !strings.Contains(HEX_CHARS, s[1:]) {
+		return 0, fmt.Errorf("invalid hex byte: %q", s)
+	}
+	return hexDigitToInt(s[0])<<4 | hexDigitToInt(s[1]), nil
+}
+
+func parseHexMask(s string) ([]maskedByte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+
+	pat := make([]maskedByte, 0, len(s)/2)
+	for len(s) > 0 {
+		if s[0] == '[' {
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return nil, errors.New("missing ']'")
+			}
+			lo, hi, found := strings.Cut(s[1:end], "-")
+			if !found {
+				hi = lo
+			}
+			b0, err := parseHexByte(lo)
+			if err != nil {
+				return nil, err
+			}
+			b1, err := parseHexByte(hi)
+			if err != nil {
+				return nil, err
+			}
+			if b0 > b1 {
+				return nil, fmt.Errorf("invalid range: %s", s[:end+1])
+			}
+			pat = append(pat, maskedByte{0xff, b0, b1})
+			s = s[end+1:]
+			continue
+		}
+
+		if len(s) < 2 || s[1] == '[' {
+			return nil, errors.New("odd number of hex digits")
+		}
+		var mb maskedByte
+		for i := 0; i < 2; i++ {
+			shift := 4 - 4*i
+			switch c := s[i]; {
+			case c == '?':
+			case strings.IndexByte(HEX_CHARS, c) != -1:
+				mb.mask |= 0x0f << shift
+				mb.lo |= hexDigitToInt(c) << shift
+			default:
+				return nil, fmt.Errorf("invalid hex char: %q", c)
+			}
+		}
+		mb.hi = mb.lo
+		pat = append(pat, mb)
+		s = s[2:]
+	}
+
+	if len(pat) == 0 {
+		return nil, errors.New("empty pattern")
+	}
+	return pat, nil
+}
+
+func newMaskMatcher(s string) (*maskMatcher, error) {
+	pat, err := parseHexMask(s)
+	if err != nil {
+		return nil, err
+	}
+	return newMaskMatcherPat(pat), nil
+}
+
+func newMaskMatcherPat(pat []maskedByte) *maskMatcher {
+	m := &maskMatcher{pat: pat}
+
+	// find the longest run of exact bytes
+	for i := 0; i < len(pat); {
+		j := i
+		for j < len(pat) && pat[j].mask == 0xff && pat[j].lo == pat[j].hi {
+			j++
+		}
+		if j-i > len(m.anchor) {
+			m.anchor = make([]byte, 0, j-i)
+			for _, mb := range pat[i:j] {
+				m.anchor = append(m.anchor, mb.lo)
+			}
+			m.anchorOff = i
+		}
+		i = j + 1
+	}
+	return m
+}
+
+func (m *maskMatcher) matchAt(buf []byte, pos int) bool {
+	for i, mb := range m.pat {
+		if b := buf[pos+i] & mb.mask; b < mb.lo || b > mb.hi {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *maskMatcher) Index(buf []byte) (int, int) {
+	n := len(m.pat)
+	for i := 0; i+n <= len(buf); i++ {
+		if len(m.anchor) > 0 {
+			j := bytes.Index(buf[i+m.anchorOff:], m.anchor)
+			if j == -1 {
+				break
+			}
+			i += j
+			if i+n > len(buf) {
+				break
+			}
+		}
+		if m.matchAt(buf, i) {
+			return i, n
+		}
+	}
+	return -1, n
+}
+
+func (m *maskMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	n := len(m.pat)
+	i := len(buf) - n
+	if i > limit-1 {
+		i = limit - 1
+	}
+	for ; i >= 0; i-- {
+		if len(m.anchor) > 0 {
+			i = bytes.LastIndex(buf[m.anchorOff:i+m.anchorOff+len(m.anchor)], m.anchor)
+			if i == -1 {
+				break
+			}
+		}
+		if m.matchAt(buf, i) {
+			return i, n
+		}
+	}
+	return -1, n
+}
+
+func (m *maskMatcher) MaxLen() int {
+	return len(m.pat)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestMaskMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		buf     string
+		want    int
+	}{
+		{"48 8b ?? ?? 00 00", "\x00\x48\x8b\x45\x10\x00\x00", 1},
+		{"48 8b ?? ?? 00 00", "\x48\x8b\x45\x10\x00\x01", -1},
+		{"4? 8b", "\x58\x8b\x4f\x8b", 2},
+		{"?5", "\x15", 0},
+		{"[a0-af] 00", "\x9f\x00\xb0\x00\xa7\x00", 4},
+		{"[11]", "\x10\x11", 1},
+		{"0x4d5a", "MZ", 0},
+		{"?? ?? 90", "\x90\x90", -1}, // does not fit
+	}
+	for _, tt := range tests {
+		m, err := newMaskMatcher(tt.pattern)
+		if err != nil {
+			t.Fatal(tt.pattern, err)
+		}
+		if got, n := m.Index([]byte(tt.buf)); got != tt.want || got != -1 && n != m.MaxLen() {
+			t.Errorf("%q in %x: %d %d, want %d", tt.pattern, tt.buf, got, n, tt.want)
+		}
+		if got, _ := m.LastIndex([]byte(tt.buf), len(tt.buf)); got != tt.want {
+			t.Errorf("%q in %x: last %d, want %d", tt.pattern, tt.buf, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "4", "4g", "[a0", "[b0-a0]", "[1-2]", "?", "4[00]"} {
+		if _, err := newMaskMatcher(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+// byte-oriented regexp: \xNN is a byte, (?i) folds only ASCII letters
+func TestRegexMatcher(t *testing.T) {
+	tests := []struct {
+		expr  string
+		buf   string
+		want  int
+		n     int
+		ascii bool // buf is searched directly
+	}{
+		{`\x89PNG`, "xx\x89PNG", 2, 4, false},
+		{`MZ.\x00`, "MZ\xc3\xa9MZ\x90\x00", 4, 4, false},
+		{`(?i)\xc9`, "\xe9\xc9", 1, 1, false},
+		{`(?i)abc\xe9`, "ABC\xc9ABC\xe9", 4, 4, false},
+		{`(?i)[\xc0-\xcf]`, "\xe0\xc5", 1, 1, false},
+		{`(?i)png`, "xx\xe2\x84\xaapNg", 5, 3, true},
+		{`(?i)k`, "\xe2\x84\xaak", 3, 1, false}, // not the Kelvin sign
+		{`\311`, "a\xc9", 1, 1, false},
+		{"é", "\xc3\xa9\xe9", 2, 1, false},
+		{`\Q.\E\xff`, "a\xff.\xff", 2, 2, false},
+		{`\Q\xff`, "\xff\\xff", 1, 4, true},
+		{`[^a]b`, "ab\xc3b", 2, 2, false},
+		{`\x{100}`, "\x00\x01", -1, 0, false},
+		{`ab\b`, "abab\xe9", 2, 2, true},
+		{`a+`, "bbaaab", 2, 3, true},
+	}
+	for _, tt := range tests {
+		m, err := newRegexMatcher(tt.expr)
+		if err != nil {
+			t.Fatal(tt.expr, err)
+		}
+		if got, n := m.Index([]byte(tt.buf)); got != tt.want || n != tt.n || m.ascii != tt.ascii {
+			t.Errorf("%q in %q: %d %d ascii %v, want %d %d %v", tt.expr, tt.buf, got, n, m.ascii, tt.want, tt.n, tt.ascii)
+		}
+	}
+
+	// overlapping matches, more than a search window back
+	m, _ := newRegexMatcher(`a+\xff?`)
+	buf := bytes.Repeat([]byte("a\xffb"), 100000)
+	lastTests := []struct{ limit, want, n int }{
+		{len(buf), len(buf) - 3, 2},
+		{len(buf) - 3, len(buf) - 6, 2},
+		{1, 0, 2},
+		{0, -1, 0},
+	}
+	for _, tt := range lastTests {
+		if got, n := m.LastIndex(buf, tt.limit); got != tt.want || n != tt.n {
+			t.Errorf("limit %d: %d %d, want %d %d", tt.limit, got, n, tt.want, tt.n)
+		}
+	}
+	m, _ = newRegexMatcher(`aa`)
+	if got, _ := m.LastIndex([]byte("xaaa"), 4); got != 2 {
+		t.Error("overlapping:", got)
+	}
+
+	if _, err := newRegexMatcher(`\1`); err == nil {
+		t.Error("backreference accepted")
+	}
+}
+
+// Index and LastIndex of the matchers against trying every position
+func TestMatchersRandom(t *testing.T) {
+	tests := []struct {
+		mode    int
+		pattern string
+		at      func(buf []byte, i int) bool // the pattern matches at i
+	}{
+		{SearchModeHex, "\x41\x61", func(buf []byte, i int) bool { return bytes.HasPrefix(buf[i:], []byte("\x41\x61")) }},
+		{SearchModeHexMask, "4? ?1 [c0-e1]", func(buf []byte, i int) bool {
+			return i+3 <= len(buf) && buf[i]>>4 == 4 && buf[i+1]&15 == 1 && buf[i+2] >= 0xc0 && buf[i+2] <= 0xe1
+		}},
+		{SearchModeMulti, `"Aa", "aA", c1 c1 c1, 00`, func(buf []byte, i int) bool {
+			for _, p := range []string{"Aa", "aA", "\xc1\xc1\xc1", "\x00"} {
+				if bytes.HasPrefix(buf[i:], []byte(p)) {
+					return true
+				}
+			}
+			return false
+		}},
+		{SearchModeRegex, `(?i)a\xc1|\x00\x00`, func(buf []byte, i int) bool {
+			return i+2 <= len(buf) && (buf[i]|0x20 == 'a' && buf[i+1] == 0xc1 || buf[i] == 0 && buf[i+1] == 0)
+		}},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	alphabet := []byte{0x00, 0x41, 0x61, 0xc1, 0xe1}
+	for _, tt := range tests {
+		m, err := newMatcher(tt.mode, 0, []byte(tt.pattern))
+		if err != nil {
+			t.Fatal(tt.pattern, err)
+		}
+		for round := 0; round < 200; round++ {
+			buf := make([]byte, rnd.Intn(40))
+			for i := range buf {
+				buf[i] = alphabet[rnd.Intn(len(alphabet))]
+			}
+			want := -1
+			for i := 0; i < len(buf) && want == -1; i++ {
+				if tt.at(buf, i) {
+					want = i
+				}
+			}
+			if got, _ := m.Index(buf); got != want {
+				t.Fatalf("%s in %x: %d, want %d", tt.pattern, buf, got, want)
+			}
+			limit := rnd.Intn(len(buf) + 1)
+			want = -1
+			for i := limit - 1; i >= 0 && want == -1; i-- {
+				if tt.at(buf, i) {
+					want = i
+				}
+			}
+			if got, _ := m.LastIndex(buf, limit); got != want {
+				t.Fatalf("%s in %x before %d: %d, want %d", tt.pattern, buf, limit, got, want)
+			}
+		}
+	}
+}
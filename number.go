@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// numeric search options, in the same flags as the text options
+const (
+	NumTypeShift = 8
+	NumTypeMask  = 0xf << NumTypeShift // index in NUM_TYPES
+	NumBigEndian = 1 << 12
+	NumAligned   = 1 << 13 // only at offsets aligned to the element width
+
+	NUM_FLAGS  = NumTypeMask | NumBigEndian | NumAligned
+	TEXT_FLAGS = TextIgnoreCase | TextUTF16LE | TextUTF16BE | TextUTF8
+)
+
+const NUM_CHARS = HEX_CHARS + "xX.-+~_"
+
+type numType struct {
+	name   string
+	size   int
+	signed bool
+	float  bool
+}
+
+// switched by Ctrl-T in the number search prompt, the first one is the default
+var NUM_TYPES = []numType{
+	{"u32", 4, false, false},
+	{"s32", 4, true, false},
+	{"u64", 8, false, false},
+	{"s64", 8, true, false},
+	{"f32", 4, true, true},
+	{"f64", 8, true, true},
+	{"u8", 1, false, false},
+	{"s8", 1, true, false},
+	{"u16", 2, false, false},
+	{"s16", 2, true, false},
+}
+
+func numTypeOf(flags int) numType {
+	i := (flags & NumTypeMask) >> NumTypeShift
+	if i >= len(NUM_TYPES) {
+		i = 0
+	}
+	return NUM_TYPES[i]
+}
+
+// next type in NUM_TYPES
+func nextNumType(flags int) int {
+	i := ((flags&NumTypeMask)>>NumTypeShift + 1) % len(NUM_TYPES)
+	return flags&^NumTypeMask | i<<NumTypeShift
+}
+
+// short description of number options, i.e. "u32,be,aligned"
+func numFlagsString(flags int) string {
+	a := []string{numTypeOf(flags).name, "le"}
+	if flags&NumBigEndian != 0 {
+		a[1] = "be"
+	}
+	if numTypeOf(flags).size == 1 {
+		a = a[:1]
+	}
+	if flags&NumAligned != 0 {
+		a = append(a, "aligned")
+	}
+	return strings.Join(a, ",")
+}
+
+// value, lo..hi range or value~tolerance, of a given type
+type numberMatcher struct {
+	typ      numType
+	order    binary.ByteOrder
+	ilo, ihi int64
+	ulo, uhi uint64
+	flo, fhi float64
+}
+
+// exact values are searched as bytes, ranges are compared value by value
+func newNumberMatcher(src string, flags int) (Matcher, error) {
+	m := &numberMatcher{typ: numTypeOf(flags), order: binary.LittleEndian}
+	if flags&NumBigEndian != 0 {
+		m.order = binary.BigEndian
+	}
+
+	src = strings.ReplaceAll(strings.TrimSpace(src), "_", "")
+	if src == "" {
+		return nil, errors.New("empty number")
+	}
+	var err error
+	exact := false
+	if from, to, ok := strings.Cut(src, ".."); ok {
+		err = m.parseRange(from, to)
+	} else if value, tol, ok := strings.Cut(src, "~"); ok {
+		err = m.parseTolerance(value, tol)
+	} else {
+		err = m.parseRange(src, src)
+		exact = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matcher Matcher = m
+	if exact && (!m.typ.float || m.flo != 0) { // floats have two zeros
+		matcher = bytesMatcher(m.encode())
+	}
+	if align := elWidth; flags&NumAligned != 0 && align > 1 {
+		matcher = alignedMatcher{matcher, align}
+	}
+	return matcher, nil
+}
+
+func (m *numberMatcher) parseRange(from, to string) error {
+	if m.typ.float {
+		lo, err := strconv.ParseFloat(strings.TrimSpace(from), 64)
+		if err != nil {
+			return err
+		}
+		hi, err := strconv.ParseFloat(strings.TrimSpace(to), 64)
+		if err != nil {
+			return err
+		}
+		if m.typ.size == 4 {
+			lo, hi = float64(float32(lo)), float64(float32(hi))
+		}
+		m.flo, m.fhi = lo, hi
+	} else if m.typ.signed {
+		lo, err := strconv.ParseInt(strings.TrimSpace(from), 0, m.typ.size*8)
+		if err != nil {
+			return m.rangeError(err)
+		}
+		hi, err := strconv.ParseInt(strings.TrimSpace(to), 0, m.typ.size*8)
+		if err != nil {
+			return m.rangeError(err)
+		}
+		m.ilo, m.ihi = lo, hi
+	} else {
+		lo, err := strconv.ParseUint(strings.TrimSpace(from), 0, m.typ.size*8)
+		if err != nil {
+			return m.rangeError(err)
+		}
+		hi, err := strconv.ParseUint(strings.TrimSpace(to), 0, m.typ.size*8)
+		if err != nil {
+			return m.rangeError(err)
+		}
+		m.ulo, m.uhi = lo, hi
+	}
+	if m.ilo > m.ihi || m.ulo > m.uhi || m.flo > m.fhi {
+		return errors.New("empty range")
+	}
+	return nil
+}
+
+func (m *numberMatcher) parseTolerance(value, tol string) error {
+	if err := m.parseRange(value, value); err != nil {
+		return err
+	}
+	if m.typ.float {
+		t, err := strconv.ParseFloat(strings.TrimSpace(tol), 64)
+		if err != nil {
+			return err
+		}
+		m.flo, m.fhi = m.flo-math.Abs(t), m.fhi+math.Abs(t)
+		return nil
+	}
+	t, err := strconv.ParseUint(strings.TrimSpace(tol), 0, 64)
+	if err != nil {
+		return m.rangeError(err)
+	}
+	// saturate at the type limits
+	if m.typ.signed {
+		bits := uint(m.typ.size*8 - 1)
+		min, max := int64(-1)<<bits, int64(1)<<bits-1
+		if t > uint64(m.ilo-min) {
+			m.ilo = min
+		} else {
+			m.ilo -= int64(t)
+		}
+		if t > uint64(max-m.ihi) {
+			m.ihi = max
+		} else {
+			m.ihi += int64(t)
+		}
+	} else {
+		max := uint64(1)<<(m.typ.size*8) - 1
+		if m.typ.size == 8 {
+			max = math.MaxUint64
+		}
+		if t > m.ulo {
+			m.ulo = 0
+		} else {
+			m.ulo -= t
+		}
+		if t > max-m.uhi {
+			m.uhi = max
+		} else {
+			m.uhi += t
+		}
+	}
+	return nil
+}
+
+func (m *numberMatcher) rangeError(err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("value out of range for %s", m.typ.name)
+	}
+	return err
+}
+
+// bytes of the exact value
+func (m *numberMatcher) encode() []byte {
+	buf := make([]byte, 8)
+	switch {
+	case m.typ.float && m.typ.size == 4:
+		m.order.PutUint32(buf, math.Float32bits(float32(m.flo)))
+	case m.typ.float:
+		m.order.PutUint64(buf, math.Float64bits(m.flo))
+	case m.typ.signed:
+		m.putUint(buf, uint64(m.ilo))
+	default:
+		m.putUint(buf, m.ulo)
+	}
+	return buf[:m.typ.size]
+}
+
+func (m *numberMatcher) putUint(buf []byte, v uint64) {
+	switch m.typ.size {
+	case 1:
+		buf[0] = byte(v)
+	case 2:
+		m.order.PutUint16(buf, uint16(v))
+	case 4:
+		m.order.PutUint32(buf, uint32(v))
+	default:
+		m.order.PutUint64(buf, v)
+	}
+}
+
+func (m *numberMatcher) uint(buf []byte) uint64 {
+	switch m.typ.size {
+	case 1:
+		return uint64(buf[0])
+	case 2:
+		return uint64(m.order.Uint16(buf))
+	case 4:
+		return uint64(m.order.Uint32(buf))
+	default:
+		return m.order.Uint64(buf)
+	}
+}
+
+func (m *numberMatcher) match(buf []byte) bool {
+	v := m.uint(buf)
+	switch {
+	case m.typ.float && m.typ.size == 4:
+		f := float64(math.Float32frombits(uint32(v)))
+		return f >= m.flo && f <= m.fhi
+	case m.typ.float:
+		f := math.Float64frombits(v)
+		return f >= m.flo && f <= m.fhi
+	case m.typ.signed:
+		bits := 64 - m.typ.size*8
+		i := int64(v<<bits) >> bits // sign extension
+		return i >= m.ilo && i <= m.ihi
+	default:
+		return v >= m.ulo && v <= m.uhi
+	}
+}
+
+func (m *numberMatcher) Index(buf []byte) (int, int) {
+	for i := 0; i+m.typ.size <= len(buf); i++ {
+		if m.match(buf[i:]) {
+			return i, m.typ.size
+		}
+	}
+	return -1, 0
+}
+
+func (m *numberMatcher) LastIndex(buf []byte, limit int) (int, int) {
+	for i := min32(limit-1, len(buf)-m.typ.size); i >= 0; i-- {
+		if m.match(buf[i:]) {
+			return i, m.typ.size
+		}
+	}
+	return -1, 0
+}
+
+func (m *numberMatcher) MaxLen() int {
+	return m.typ.size
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	CONFIRM_WRITE_SIZE = 1024 * 1024 // bigger writes ask first
+	WRITE_CHUNK_SIZE   = 1024 * 1024 // writes too big to undo are streamed
+)
+
+// data of a range being written, index is the position of buf in the range
+type rangeGen func(buf []byte, index int64) error
+
+type rangeWrite struct {
+	offset, size int64
+	gen          rangeGen
+	backward     bool // streamed from the end, i.e. copying to a higher overlapping offset
+}
+
+// writes the ranges to the file as one undo entry, if not too big
+func writeRanges(what string, ws []rangeWrite) bool {
+	if !allowWrite {
+		showErrStr(ERR_WRITE_NOT_ALLOWED)
+		return false
+	}
+	if !doc.IsIdentity() {
+		showError(errNotIdentity)
+		return false
+	}
+	total := int64(0)
+	for _, w := range ws {
+		if w.offset < 0 || w.size < 0 || w.offset > fileSize || w.size > fileSize-w.offset {
+			showErrStr(what, ": out of the file: ", fmt.Sprintf("%X+%X", offset2ea(w.offset), w.size))
+			return false
+		}
+		total += w.size
+	}
+	if total == 0 {
+		showErrStr(what, ": nothing to write")
+		return false
+	}
+
+	undoable := total <= MAX_UNDO_CHUNK_SIZE
+	if !undoable {
+		if !confirm(fmt.Sprintf("0x%x bytes are too many to undo, write anyway? (y/n) ", total)) {
+			return false
+		}
+	} else if total >= CONFIRM_WRITE_SIZE && !confirm(fmt.Sprintf("%s 0x%x bytes? (y/n) ", what, total)) {
+		return false
+	}
+
+	var err error
+	if undoable {
+		err = writeUndoable(ws)
+	} else {
+		err = writeStreamed(ws)
+	}
+	for _, w := range ws {
+		doc.Revert(w.offset, w.size)
+	}
+	docChanged()
+	if err != nil {
+		showError(err)
+		return false
+	}
+	return true
+}
+
+// all the data is generated before writing, so the ranges may overlap the source of a copy
+func writeUndoable(ws []rangeWrite) error {
+	chunks := make([]UndoChunk, 0, len(ws))
+	for _, w := range ws {
+		old, err := readOriginal(w.offset, w.size)
+		if err != nil {
+			return err
+		}
+		data := make([]byte, w.size)
+		if err := w.gen(data, 0); err != nil {
+			return err
+		}
+		chunks = append(chunks, UndoChunk{w.offset, old, data})
+	}
+	undoJournal.RecordDisk(chunks)
+	for i, c := range chunks {
+		if n, err := writeAt(c.Offset, c.New); err != nil {
+			undoJournal.KeepWritten(chunks, i, int64(n))
+			return err
+		}
+	}
+	return nil
+}
+
+func writeStreamed(ws []rangeWrite) error {
+	f, err := os.OpenFile(fname, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, WRITE_CHUNK_SIZE)
+	for _, w := range ws {
+		for done := int64(0); done < w.size; {
+			n := min64(w.size-done, WRITE_CHUNK_SIZE)
+			index := done
+			if w.backward {
+				index = w.size - done - n
+			}
+			if err := w.gen(buf[:n], index); err != nil {
+				return err
+			}
+			if _, err := f.WriteAt(buf[:n], w.offset+index); err != nil {
+				return err
+			}
+			done += n
+		}
+	}
+	return f.Close()
+}
+
+// fill pattern: hex bytes "00 ff", text "\"abc\\n\"", or an incrementing sequence seq(start[, step[, width]]),
+// width is 1, 2, 4 or 8 bytes, seq_be() is big-endian
+func parseFillPattern(s string) (rangeGen, error) {
+	s = strings.TrimSpace(s)
+	var pattern []byte
+	switch {
+	case s == "":
+		return nil, errors.New("need pattern")
+	case s[0] == '"':
+		text, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid text: %s", s)
+		}
+		pattern = []byte(text)
+	case strings.HasPrefix(s, "seq(") || strings.HasPrefix(s, "seq_be("):
+		return parseSeqPattern(s)
+	default:
+		hex := strings.Join(strings.Fields(s), "")
+		for i := 0; i < len(hex); i++ {
+			if !strings.ContainsRune(HEX_CHARS, rune(hex[i])) {
+				return nil, fmt.Errorf("invalid hex pattern: %s (text is in quotes)", s)
+			}
+		}
+		pattern = fromHex(hex)
+	}
+	if len(pattern) == 0 {
+		return nil, errors.New("empty pattern")
+	}
+	return func(buf []byte, index int64) error {
+		for i := range buf {
+			buf[i] = pattern[(index+int64(i))%int64(len(pattern))]
+		}
+		return nil
+	}, nil
+}
+
+func parseSeqPattern(s string) (rangeGen, error) {
+	bigEndian := strings.HasPrefix(s, "seq_be(")
+	if !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("missing ')': %s", s)
+	}
+	args := strings.Split(s[strings.IndexByte(s, '(')+1:len(s)-1], ",")
+	if len(args) > 3 {
+		return nil, errors.New("seq: need (start[, step[, width]])")
+	}
+	v := []int64{0, 1, 1} // start, step, width
+	for i, a := range args {
+		val, err := parseExprRadix(a, 16)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = val
+	}
+	start, step, width := v[0], v[1], v[2]
+	if width != 1 && width != 2 && width != 4 && width != 8 {
+		return nil, fmt.Errorf("seq: invalid width: %d, need 1, 2, 4 or 8", width)
+	}
+	return func(buf []byte, index int64) error {
+		for i := range buf {
+			pos := index + int64(i)
+			val := start + step*(pos/width)
+			shift := pos % width
+			if bigEndian {
+				shift = width - 1 - shift
+			}
+			buf[i] = byte(uint64(val) >> (8 * shift))
+		}
+		return nil
+	}, nil
+}
+
+func zeroGen(buf []byte, index int64) error {
+	for i := range buf {
+		buf[i] = 0
+	}
+	return nil
+}
+
+// copy of the data at src, as it's seen now
+func copyGen(src int64) rangeGen {
+	return func(buf []byte, index int64) error {
+		_, err := reader.ReadAt(buf, src+index)
+		return err
+	}
+}
+
+// first n arguments and the rest as is. The arguments are separated by commas if there are any outside of
+// quotes and brackets, so they can be expressions with spaces: "main + 10, 20", else by spaces
+func cutArgs(args string, n int) []string {
+	if a := cutArgsAt(args, n, ','); a != nil {
+		return a
+	}
+	return cutArgsAt(args, n, ' ')
+}
+
+// nil if there is no separator for sep ','
+func cutArgsAt(args string, n int, sep byte) []string {
+	a := make([]string, 0, n+1)
+	args = strings.TrimSpace(args)
+	depth, quoted := 0, false
+	for i := 0; i < len(args) && len(a) < n; i++ {
+		switch c := args[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			a = append(a, strings.TrimSpace(args[:i]))
+			args = strings.TrimLeft(args[i+1:], " ")
+			i = -1
+		}
+	}
+	if sep == ',' && len(a) == 0 {
+		return nil
+	}
+	if args != "" {
+		a = append(a, args)
+	}
+	return a
+}
+
+// file range from address and size expressions
+func parseRange(what, addrExpr, sizeExpr string) (int64, int64, bool) {
+	ea, err := parseExprRadix(addrExpr, 16)
+	if err != nil {
+		showError(err)
+		return 0, 0, false
+	}
+	size, err := parseExprRadix(sizeExpr, 16)
+	if err != nil {
+		showError(err)
+		return 0, 0, false
+	}
+	off := ea2offset(ea)
+	if off < 0 || size <= 0 || off >= fileSize || size > fileSize-off {
+		showErrStr(what, ": invalid range: ", fmt.Sprintf("%X+%X", ea, size))
+		return 0, 0, false
+	}
+	return off, size, true
+}
+
+// fill <start> <len> <pattern>
+func cmd_fill(args string) {
+	a := cutArgs(args, 2)
+	if len(a) < 3 {
+		showErrStr("fill: need <start> <len> <pattern>")
+		return
+	}
+	off, size, ok := parseRange("fill", a[0], a[1])
+	if !ok {
+		return
+	}
+	gen, err := parseFillPattern(a[2])
+	if err != nil {
+		showErrStr("fill: ", err)
+		return
+	}
+	if writeRanges("fill", []rangeWrite{{off, size, gen, false}}) {
+		showMsg(fmt.Sprintf("0x%x bytes filled", size))
+	}
+}
+
+// zero [<start> <len>], the selection without arguments
+func cmd_zero(args string) {
+	a := cutArgs(args, 2)
+	var off, size int64
+	switch len(a) {
+	case 0:
+		var ok bool
+		if off, size, ok = selection(); !ok {
+			showErrStr("zero: need <start> <len> or a selection")
+			return
+		}
+	case 2:
+		var ok bool
+		if off, size, ok = parseRange("zero", a[0], a[1]); !ok {
+			return
+		}
+	default:
+		showErrStr("zero: need <start> <len> or a selection")
+		return
+	}
+	if writeRanges("zero", []rangeWrite{{off, size, zeroGen, false}}) {
+		showMsg(fmt.Sprintf("0x%x bytes zeroed", size))
+	}
+}
+
+// copy <src> <dst> <len>
+func cmd_copy(args string) {
+	copyRange("copy", "copied", args, false)
+}
+
+// move <src> <dst> <len>: copy, then the part of the source not overwritten is zeroed
+func cmd_move(args string) {
+	copyRange("move", "moved", args, true)
+}
+
+func copyRange(what, done, args string, move bool) {
+	a := cutArgs(args, 3)
+	if len(a) != 3 {
+		showErrStr(what, ": need <src> <dst> <len>")
+		return
+	}
+	src, size, ok := parseRange(what, a[0], a[2])
+	if !ok {
+		return
+	}
+	dst, _, ok := parseRange(what, a[1], a[2])
+	if !ok {
+		return
+	}
+	if src == dst {
+		showErrStr(what, ": same source and destination")
+		return
+	}
+
+	ws := []rangeWrite{{dst, size, copyGen(src), dst > src}}
+	if move {
+		// source left uncovered by the destination
+		start, end := src, src+size
+		if dst < end && dst+size > start {
+			if dst > src {
+				end = dst
+			} else {
+				start = dst + size
+			}
+		}
+		ws = append(ws, rangeWrite{start, end - start, zeroGen, false})
+	}
+	if writeRanges(what, ws) {
+		showMsg(fmt.Sprintf("0x%x bytes %s %X -> %X", size, done, offset2ea(src), offset2ea(dst)))
+	}
+}
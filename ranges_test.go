@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// generated bytes from an index in the range, as if the range was written in chunks
+func TestFillPatterns(t *testing.T) {
+	tests := []struct {
+		pattern string
+		index   int64
+		n       int
+		want    string // hex
+	}{
+		{"ff", 0, 3, "ffffff"},
+		{"aa bb", 0, 5, "aabbaabbaa"},
+		{"AABBCC", 4, 4, "bbccaabb"},
+		{`"ab\x00"`, 1, 4, "62006162"},
+		{"seq(fe)", 0, 4, "feff0001"},
+		{"seq(0, 2)", 10, 3, "141618"},
+		{"seq(fffe, 1, 2)", 0, 6, "feffffff0000"},
+		{"seq(fffe, 1, 2)", 3, 2, "ff00"},
+		{"seq_be(1, 0n2, 2)", 0, 4, "00010003"},
+		{"seq_be(1, 1, 4)", 4, 4, "00000002"},
+		{"seq(-1, 0, 8)", 0, 8, "ffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		gen, err := parseFillPattern(tt.pattern)
+		if err != nil {
+			t.Fatal(tt.pattern, err)
+		}
+		buf := make([]byte, tt.n)
+		if err := gen(buf, tt.index); err != nil {
+			t.Fatal(tt.pattern, err)
+		}
+		if got := fmt.Sprintf("%x", buf); got != tt.want {
+			t.Errorf("%s at %d: %s, want %s", tt.pattern, tt.index, got, tt.want)
+		}
+	}
+
+	errs := []struct{ pattern, want string }{
+		{"", "need pattern"},
+		{"xyz", "invalid hex pattern"},
+		{`"abc`, "invalid text"},
+		{`""`, "empty pattern"},
+		{"seq(1, 2", "missing ')'"},
+		{"seq(1, 1, 3)", "invalid width: 3"},
+		{"seq(1, 1, 1, 1)", "need (start"},
+		{"seq(zz)", "invalid number"},
+	}
+	for _, tt := range errs {
+		if _, err := parseFillPattern(tt.pattern); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: %v, want %q", tt.pattern, err, tt.want)
+		}
+	}
+}
+
+func TestCutArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		n    int
+		want string
+	}{
+		{"10 20 ff 00", 2, `["10" "20" "ff 00"]`},
+		{"10 20", 2, `["10" "20"]`},
+		{"10", 2, `["10"]`},
+		{"", 2, `[]`},
+		{"main + 10, 20, aa bb", 2, `["main + 10" "20" "aa bb"]`},
+		{`20, 3, "a,b"`, 2, `["20" "3" "\"a,b\""]`},
+		{"byte(1, 2) 5", 1, `["byte(1, 2)" "5"]`},
+		{"seq(1, 2)", 2, `["seq(1, 2)"]`},
+		{"10, 4, seq(1, 2)", 2, `["10" "4" "seq(1, 2)"]`},
+		{"[$ + 8], 4", 2, `["[$ + 8]" "4"]`},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprintf("%q", cutArgs(tt.args, tt.n)); got != tt.want {
+			t.Errorf("%q: %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	MAX_SEARCH_WORKERS = 16
+	MIN_SCAN_CHUNK     = 1024 * 1024
+)
+
+var searchWorkers int64 = 0 // goroutines matching chunks in parallel, 0 = number of CPUs
+
+func numSearchWorkers() int {
+	n := int(searchWorkers)
+	if n <= 0 {
+		n = min32(runtime.NumCPU(), MAX_SEARCH_WORKERS)
+	}
+	return n
+}
+
+// the chunks get smaller with more workers, so their buffers take about bufSize in total
+func scanChunkSize() int64 {
+	size := int64(bufSize)
+	for n := numSearchWorkers(); n > 1 && size > MIN_SCAN_CHUNK; n /= 2 {
+		size /= 2
+	}
+	return size
+}
+
+// chunk of the scanned range, matches must start within [off, off+size)
+type scanChunk struct {
+	seq  int
+	off  int64
+	size int
+	hits []int64
+	err  error
+}
+
+// reads and matches chunks on worker goroutines, up to 2 chunks per worker in flight.
+// next() yields the chunks in scan order, scan() fills in the hits of a chunk using a worker-owned buffer of bufLen bytes.
+// Finished chunks are passed to done() in order, on the calling goroutine, until it returns false.
+// step() is called on the calling goroutine with the scan position (starting at pos) at least every progressInterval,
+// it can stop the scan by returning false. All workers are finished on return
+func parallelScan(pos int64, bufLen int, next func() (int64, int, bool), scan func(c *scanChunk, buf []byte),
+	step func(pos int64) bool, done func(c *scanChunk) bool) {
+
+	workers := numSearchWorkers()
+	jobs := make(chan *scanChunk)
+	results := make(chan *scanChunk, workers)
+	inFlight := make(chan struct{}, 2*workers)
+	quit := make(chan struct{})
+
+	go func() {
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case inFlight <- struct{}{}:
+			case <-quit:
+				return
+			}
+			off, size, ok := next()
+			if !ok {
+				return
+			}
+			select {
+			case jobs <- &scanChunk{seq: seq, off: off, size: size}:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, bufLen)
+			for c := range jobs {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				scan(c, buf)
+				select {
+				case results <- c:
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	// chunks finish out of order, deliver them in sequence so the earliest hit wins
+	pending := make(map[int]*scanChunk)
+	nextSeq := 0
+	stopped := false
+	stop := func() {
+		if !stopped {
+			stopped = true
+			close(quit)
+		}
+	}
+	for {
+		select {
+		case c, ok := <-results:
+			if !ok {
+				return
+			}
+			if stopped {
+				continue // draining
+			}
+			pending[c.seq] = c
+			for c := pending[nextSeq]; c != nil; c = pending[nextSeq] {
+				delete(pending, nextSeq)
+				nextSeq++
+				<-inFlight
+				pos = c.off
+				if !step(pos) || !done(c) {
+					stop()
+					break
+				}
+			}
+		case <-ticker.C:
+			if !stopped && !step(pos) {
+				stop()
+			}
+		}
+	}
+}
+
+// scans [from, limit) for matches, calling found() with each match offset in order until it returns false.
+// step() is called periodically with the current offset, it can stop the scan by returning false
+func scanForward(m Matcher, from, limit int64, step func(pos int64) bool, found func(pos int64) bool) error {
+	overlap := m.MaxLen() - 1
+	align := matchAlign(m)
+	chunkSize := scanChunkSize()
+	var err error
+
+	pos := from
+	next := func() (int64, int, bool) {
+		for pos < limit {
+			if skip := findNextData(pos); skip != -1 { // skip sparse regions
+				pos = skip
+				continue
+			}
+			// keep the chunks aligned, for block devices
+			end := min64((pos/chunkSize+1)*chunkSize, limit)
+			off := pos
+			pos = end
+			return off, int(end - off), true
+		}
+		return 0, 0, false
+	}
+
+	scan := func(c *scanChunk, buf []byte) {
+		// read past the chunk end for the matches crossing it
+		n := int(min64(int64(c.size+overlap), limit-c.off))
+		n, rerr := reader.ReadAt(buf[:n], c.off)
+		if rerr != nil && rerr != io.EOF {
+			c.err = rerr
+			return
+		}
+		for k := 0; k < c.size && k <= n; {
+			index, _ := m.Index(buf[k:n])
+			if index == -1 || k+index >= c.size {
+				break
+			}
+			if pos := c.off + int64(k+index); pos%align == 0 {
+				c.hits = append(c.hits, pos)
+			}
+			k += index + 1
+		}
+	}
+
+	parallelScan(from, int(chunkSize)+overlap, next, scan, step, func(c *scanChunk) bool {
+		if c.err != nil {
+			err = c.err
+			return false
+		}
+		for _, pos := range c.hits {
+			if !found(pos) {
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// finds the last match starting in [lo, before) and ending before hi, returns -1 if none.
+// step() is called periodically with the current offset, it can stop the scan by returning false
+func scanBackward(m Matcher, lo, hi, before int64, step func(pos int64) bool) (int64, error) {
+	overlap := m.MaxLen() - 1
+	align := matchAlign(m)
+	chunkSize := scanChunkSize()
+	result := int64(-1)
+	var err error
+
+	pos := hi // end of the unscanned range
+	next := func() (int64, int, bool) {
+		for pos > lo {
+			if skip := findPrevData(pos); skip != -1 { // skip sparse regions
+				pos = skip
+				continue
+			}
+			start := max64((pos-1)/chunkSize*chunkSize, lo)
+			end := pos
+			pos = start
+			return start, int(end - start), true
+		}
+		return 0, 0, false
+	}
+
+	scan := func(c *scanChunk, buf []byte) {
+		limit := int(min64(int64(c.size), before-c.off))
+		if limit <= 0 {
+			return
+		}
+		n := int(min64(int64(c.size+overlap), hi-c.off))
+		n, rerr := reader.ReadAt(buf[:n], c.off)
+		if rerr != nil && rerr != io.EOF {
+			c.err = rerr
+			return
+		}
+		for limit = min32(limit, n); limit > 0; {
+			index, _ := m.LastIndex(buf[:n], limit)
+			if index == -1 {
+				break
+			}
+			if pos := c.off + int64(index); pos%align == 0 {
+				c.hits = append(c.hits, pos)
+				break
+			}
+			limit = index
+		}
+	}
+
+	parallelScan(hi, int(chunkSize)+overlap, next, scan, step, func(c *scanChunk) bool {
+		if c.err != nil {
+			err = c.err
+			return false
+		}
+		if len(c.hits) > 0 {
+			result = c.hits[0]
+			return false
+		}
+		return true
+	})
+	return result, err
+}
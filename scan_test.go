@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// temp file with the data, opened as the current document
+func openTestFile(t testing.TB, data []byte) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	fname, fileSize = f.Name(), int64(len(data))
+	doc = NewDocument(f, fileSize)
+	reader = doc
+	sparseMap = make([]Range, 0)
+	cursor, offset = 0, 0
+}
+
+// chunks finishing out of order are delivered in order, nothing is delivered after done() stops the scan
+func TestParallelScanOrder(t *testing.T) {
+	defer func(n int64) { searchWorkers = n }(searchWorkers)
+	searchWorkers = 8
+
+	tests := []struct {
+		chunks int
+		stopAt int // done() returns false for this chunk, -1 to scan all
+	}{
+		{0, -1},
+		{1, -1},
+		{100, -1},
+		{100, 0},
+		{100, 37},
+	}
+	for _, tt := range tests {
+		i := 0
+		next := func() (int64, int, bool) {
+			if i == tt.chunks {
+				return 0, 0, false
+			}
+			i++
+			return int64(i-1) * 10, 10, true
+		}
+		var running atomic.Int32
+		scan := func(c *scanChunk, buf []byte) {
+			running.Add(1)
+			defer running.Add(-1)
+			time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+			c.hits = append(c.hits, c.off)
+		}
+		delivered := 0
+		parallelScan(0, 10, next, scan, func(pos int64) bool { return true }, func(c *scanChunk) bool {
+			if c.seq != delivered || c.off != int64(delivered)*10 || len(c.hits) != 1 {
+				t.Fatalf("%+v: chunk %d delivered as %d", tt, c.seq, delivered)
+			}
+			delivered++
+			return c.seq != tt.stopAt
+		})
+		want := tt.chunks
+		if tt.stopAt != -1 {
+			want = tt.stopAt + 1
+		}
+		if delivered != want || running.Load() != 0 {
+			t.Errorf("%+v: %d delivered, want %d, %d running", tt, delivered, want, running.Load())
+		}
+	}
+}
+
+// matches across chunk boundaries, forward and backward, with one and several workers
+func TestScanForwardBackward(t *testing.T) {
+	defer func(n int64) { searchWorkers = n }(searchWorkers)
+	searchWorkers = 4
+	chunk := int(scanChunkSize())
+
+	data := make([]byte, 3*chunk+1000)
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Read(data)
+	pattern := []byte("needle")
+	positions := []int{0, 100, chunk - 3, chunk + 3, 2*chunk - 1, 2*chunk + 5, len(data) - len(pattern)}
+	for _, pos := range positions {
+		copy(data[pos:], pattern)
+	}
+	openTestFile(t, data)
+
+	m, err := newMatcher(SearchModeText, 0, pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int64{1, 4} {
+		searchWorkers = workers
+		hits := make([]int, 0)
+		err := scanForward(m, 0, fileSize, func(pos int64) bool { return true }, func(pos int64) bool {
+			hits = append(hits, int(pos))
+			return true
+		})
+		if err != nil || len(hits) != len(positions) {
+			t.Fatalf("workers %d: %v %x", workers, err, hits)
+		}
+		for i := range hits {
+			if hits[i] != positions[i] {
+				t.Fatalf("workers %d: %x, want %x", workers, hits, positions)
+			}
+		}
+
+		for _, before := range []int64{fileSize, int64(positions[6]), int64(2*chunk + 5), int64(chunk + 1), 1, 0} {
+			want := int64(bytes.LastIndex(data[:min64(before+int64(len(pattern))-1, fileSize)], pattern))
+			if want >= before {
+				want = -1
+			}
+			got, err := scanBackward(m, 0, fileSize, before, func(pos int64) bool { return true })
+			if err != nil || got != want {
+				t.Errorf("workers %d, before %X: %X %v, want %X", workers, before, got, err, want)
+			}
+		}
+	}
+}
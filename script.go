@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	RC_FILE_NAME     = "rc"
+	MAX_SOURCE_DEPTH = 16 // scripts sourcing scripts
+)
+
+func init() {
+	addCommand("source", cmd_source, "<file>", "run commands from a file")
+}
+
+var (
+	startupCmds []string // -c/--command, run after the rc file
+	sourceDepth int
+)
+
+// runs a command, returning the error it has shown, if any
+func run_cmd_err(cmd string) error {
+	lastErrMsg = ""
+	run_cmd(cmd)
+	if lastErrMsg != "" {
+		return errors.New(lastErrMsg)
+	}
+	return nil
+}
+
+// runs the commands one by one, errors are prefixed with "name:line: "
+func runScript(name string, lines []string) []string {
+	errs := make([]string, 0)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if err := run_cmd_err(line); err != nil {
+			errs = append(errs, fmt.Sprintf("%s:%d: %s", name, i+1, err))
+		}
+	}
+	return errs
+}
+
+func sourceFile(fname string) ([]string, error) {
+	if sourceDepth >= MAX_SOURCE_DEPTH {
+		return nil, fmt.Errorf("%s: too many nested scripts", fname)
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sourceDepth++
+	defer func() { sourceDepth-- }()
+	return runScript(filepath.Base(fname), lines), nil
+}
+
+// single error goes to the status line, more of them are listed
+func showScriptErrors(errs []string) {
+	switch len(errs) {
+	case 0:
+	case 1:
+		showErrStr(errs[0])
+	default:
+		if sourceDepth > 0 {
+			// nested script, the outer one shows them
+			showErrStr(strings.Join(errs, "; "))
+			return
+		}
+		panel := &ListPanel{
+			Title: fmt.Sprintf("%d errors", len(errs)),
+			Len:   func() int { return len(errs) },
+			Line:  func(i int) string { return errs[i] },
+			Keys:  "esc: close",
+		}
+		panel.Run(func(*tcell.EventKey, int) bool { return false })
+		showErrStr(errs[0], fmt.Sprintf(" (+%d more)", len(errs)-1))
+	}
+}
+
+// source <file>
+func cmd_source(args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		showErrStr("source: need file name")
+		return
+	}
+	errs, err := sourceFile(args)
+	if err != nil {
+		showError(err)
+		return
+	}
+	showScriptErrors(errs)
+}
+
+func rcFileName() string {
+	path, err := getAppDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(path, RC_FILE_NAME)
+}
+
+// rc file from the app dir, then the -c commands
+func runStartupScripts() {
+	prevErrMsg := lastErrMsg // i.e. session loading error
+	errs := make([]string, 0)
+	if fname := rcFileName(); fname != "" {
+		rcErrs, err := sourceFile(fname)
+		if err != nil && !os.IsNotExist(err) {
+			rcErrs = []string{err.Error()}
+		}
+		errs = append(errs, rcErrs...)
+	}
+	errs = append(errs, runScript("-c", startupCmds)...)
+	if len(errs) == 0 {
+		lastErrMsg = prevErrMsg
+	}
+	showScriptErrors(errs)
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"strings"
 )
 
@@ -49,7 +48,7 @@ func fromHex(hexStr string) []byte {
 }
 
 func searchUI(dir bool) {
-	newPattern := askPattern("find ", g_searchPattern)
+	newPattern := askPattern("find ", &g_searchMode, &g_searchFlags, SearchModeMax, g_searchPattern)
 	if newPattern != nil && len(newPattern) > 0 {
 		g_searchPattern = newPattern
 		if dir {
@@ -61,119 +60,81 @@ func searchUI(dir bool) {
 }
 
 func searchPrev() bool {
-	buf := make([]byte, bufSize)
-	patLen := len(g_searchPattern)
-	window := make([]byte, 0)
-
-	if offset <= 0 {
+	m, err := newMatcher(g_searchMode, g_searchFlags, g_searchPattern)
+	if err != nil {
+		showError(err)
 		return false
 	}
-	newOffset := offset - bufSize + int64(patLen) - 1
-	if newOffset < 0 {
-		newOffset = 0
+
+	// search within the selection, if any
+	fixSelection()
+	lo, hi := int64(0), min64(cursor+int64(m.MaxLen())-1, fileSize)
+	if start, size, ok := selection(); ok {
+		lo = start
+		hi = min64(hi, start+size)
+	}
+	if cursor <= lo {
+		return false
 	}
 
+	interrupted := false
 	resetProgress()
-	for {
-		if checkInterrupt() {
-			return true // don't beep
-		}
-
-		skipOffset := findPrevData(newOffset + bufSize) // skip sparse regions
-		if skipOffset != -1 {
-			newOffset = skipOffset - bufSize
-			if newOffset < 0 {
-				newOffset = 0
-			}
-			window = make([]byte, 0)
-		}
-		updateProgress(newOffset)
-
-		nRead, _ := reader.ReadAt(buf, newOffset)
-		if nRead > 0 {
-			if newOffset+int64(nRead) > offset+int64(patLen) {
-				nRead = int(offset - newOffset + int64(patLen) - 1)
-			}
-
-			window = append(buf[:nRead], window...)
-			index := bytes.LastIndex(window, g_searchPattern)
-
-			if index != -1 {
-				newOffset += int64(index)
-				if newOffset < offset {
-					offset = newOffset
-				}
-				return true
+	pos, err := scanBackward(m, lo, hi, cursor,
+		func(pos int64) bool {
+			if checkInterrupt() {
+				interrupted = true
+				return false
 			}
-
-			// Shrink the window to avoid unbounded growth
-			if len(window) > patLen {
-				window = window[:patLen]
-			}
-		} else {
-			return false
-		}
-
-		if newOffset == 0 {
-			return false
-		}
-
-		// Update the new offset (move backward)
-		newOffset -= int64(nRead)
-		if newOffset < 0 {
-			newOffset = 0
-		}
+			updateProgress(pos)
+			return true
+		})
+	if err != nil {
+		showError(err)
+	}
+	if pos != -1 {
+		setCursor(pos)
+		showMatch(m, pos)
+		return true
 	}
+	return interrupted // don't beep if interrupted
 }
 
 // don't use bufio.NewReader bc it fails to work with PhysicalDrives on windows
 func searchNext() bool {
-	buf := make([]byte, bufSize)
-	patLen := len(g_searchPattern)
-	window := make([]byte, 0)
-
-	newOffset := offset + 1
-	resetProgress()
-	for newOffset < fileSize {
-		if checkInterrupt() {
-			return true // don't beep
-		}
-
-		skipOffset := findNextData(newOffset) // skip sparse regions
-		if skipOffset != -1 {
-			newOffset = skipOffset
-			window = make([]byte, 0)
-		}
-		updateProgress(newOffset)
-
-		n, err := reader.ReadAt(buf, newOffset)
-		if n > 0 {
-			window = append(window, buf[:n]...)
-
-			// Search for the pattern in the current window
-			index := bytes.Index(window, g_searchPattern)
-			if index != -1 {
-				offset = newOffset + int64(index) - int64(len(window)) + int64(n)
-				return true
-			}
+	m, err := newMatcher(g_searchMode, g_searchFlags, g_searchPattern)
+	if err != nil {
+		showError(err)
+		return false
+	}
 
-			// Shrink the window to avoid unbounded growth
-			if len(window) > patLen {
-				window = window[len(window)-patLen:]
-			}
-		}
+	// search within the selection, if any
+	fixSelection()
+	from := cursor + 1
+	limit := fileSize
+	if start, size, ok := selection(); ok {
+		from = max64(from, start)
+		limit = start + size
+	}
 
-		// Break the loop if EOF is reached
-		if err != nil {
-			if err.Error() != "EOF" {
-				showError(err)
+	found, interrupted := false, false
+	resetProgress()
+	err = scanForward(m, from, limit,
+		func(pos int64) bool {
+			if checkInterrupt() {
+				interrupted = true
+				return false
 			}
+			updateProgress(pos)
+			return true
+		},
+		func(pos int64) bool {
+			setCursor(pos)
+			showMatch(m, pos)
+			found = true
 			return false
-		}
-
-		// Update the local offset
-		newOffset += int64(n)
+		})
+	if err != nil {
+		showError(err)
 	}
-
-	return false
+	return found || interrupted // don't beep if interrupted
 }
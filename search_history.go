@@ -23,41 +23,45 @@ type SearchHistory struct {
 
 type SearchHistoryEntry struct {
 	Mode    int
+	Flags   int `json:",omitempty"` // text search options: case, encodings
 	Pattern []byte
 	Ts      int64
 }
 
 var searchHistory = &SearchHistory{}
 
-func (sh *SearchHistory) Add(mode int, pattern []byte) {
+func (sh *SearchHistory) Add(mode, flags int, pattern []byte) {
 	if !sh.ready {
 		return
 	}
 	if len(pattern) == 0 {
 		return
 	}
-	if len(sh.entries) > 0 && sh.entries[len(sh.entries)-1].Mode == mode && bytes.Equal(sh.entries[len(sh.entries)-1].Pattern, pattern) {
-		return
+	if len(sh.entries) > 0 {
+		last := sh.entries[len(sh.entries)-1]
+		if last.Mode == mode && last.Flags == flags && bytes.Equal(last.Pattern, pattern) {
+			return
+		}
 	}
-	sh.entries = append(sh.entries, SearchHistoryEntry{Mode: mode, Pattern: pattern, Ts: time.Now().UnixNano()})
+	sh.entries = append(sh.entries, SearchHistoryEntry{Mode: mode, Flags: flags, Pattern: pattern, Ts: time.Now().UnixNano()})
 	sh.pos = len(sh.entries) - 1
-	go sh.Save()
+	go func() { postError("search history: ", sh.Save()) }()
 }
 
-func (sh *SearchHistory) Prev() (int, []byte) {
+func (sh *SearchHistory) Prev() *SearchHistoryEntry {
 	if sh.ready && sh.pos > 0 {
 		sh.pos--
-		return sh.entries[sh.pos].Mode, sh.entries[sh.pos].Pattern
+		return &sh.entries[sh.pos]
 	}
-	return -1, nil
+	return nil
 }
 
-func (sh *SearchHistory) Next() (int, []byte) {
+func (sh *SearchHistory) Next() *SearchHistoryEntry {
 	if sh.ready && sh.pos < len(sh.entries)-1 {
 		sh.pos++
-		return sh.entries[sh.pos].Mode, sh.entries[sh.pos].Pattern
+		return &sh.entries[sh.pos]
 	}
-	return -1, nil
+	return nil
 }
 
 func (sh *SearchHistory) fileName() string {
@@ -68,16 +72,15 @@ func (sh *SearchHistory) fileName() string {
 	return filepath.Join(path, "search_history.json")
 }
 
-func (sh *SearchHistory) Save() {
+func (sh *SearchHistory) Save() error {
 	fname := sh.fileName()
 	if fname == "" {
-		return
+		return nil
 	}
 
 	err := os.MkdirAll(filepath.Dir(fname), 0700)
 	if err != nil {
-		lastErrMsg = "[?] " + err.Error()
-		return
+		return err
 	}
 
 	merged := sh
@@ -85,7 +88,9 @@ func (sh *SearchHistory) Save() {
 	fi, err := os.Stat(fname)
 	if err == nil && (fi.ModTime() != sh.fileTimestamp || fi.Size() != sh.fileSize) {
 		merged = &SearchHistory{}
-		merged.Load()
+		if err := merged.Load(); err != nil {
+			return err
+		}
 		merged.entries = append(merged.entries, sh.entries...)
 		merged.sort_uniq()
 	}
@@ -98,12 +103,11 @@ func (sh *SearchHistory) Save() {
 
 	f, err := os.Create(fname)
 	if err != nil {
-		lastErrMsg = "[?] " + err.Error()
+		return err
 	}
 	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.Encode(entries)
+	return json.NewEncoder(f).Encode(entries)
 }
 
 func (sh *SearchHistory) sort_uniq() {
@@ -120,29 +124,33 @@ func (sh *SearchHistory) sort_uniq() {
 	}
 }
 
-func initSearchHistory() {
-	searchHistory.Load()
+// runs in the background, the error is shown by the caller
+func initSearchHistory() error {
+	err := searchHistory.Load()
 	if searchHistory.ready && len(searchHistory.entries) > 0 {
 		lastSearch := searchHistory.entries[len(searchHistory.entries)-1]
 		g_searchMode = lastSearch.Mode
+		g_searchFlags = lastSearch.Flags
 		g_searchPattern = lastSearch.Pattern
 	}
+	return err
 }
 
-func (sh *SearchHistory) Load() {
-	sh.tryLoad()
+func (sh *SearchHistory) Load() error {
+	err := sh.tryLoad()
 	sh.pos = len(sh.entries)
 	sh.ready = true
+	return err
 }
 
-func (sh *SearchHistory) tryLoad() {
+func (sh *SearchHistory) tryLoad() error {
 	fname := sh.fileName()
 	if fname == "" {
-		return
+		return nil
 	}
 	fi, err := os.Stat(fname)
 	if err != nil {
-		return
+		return nil
 	}
 
 	sh.fileTimestamp = fi.ModTime()
@@ -150,12 +158,10 @@ func (sh *SearchHistory) tryLoad() {
 
 	f, err := os.Open(fname)
 	if err != nil {
-		return
+		return nil
 	}
 	defer f.Close()
 
 	dec := json.NewDecoder(f)
-	if err := dec.Decode(&sh.entries); err != nil {
-		lastErrMsg = "[?] " + err.Error()
-	}
+	return dec.Decode(&sh.entries)
 }
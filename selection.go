@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	selActive    bool  = false
+	selExtending bool  = false // selection end follows the cursor
+	selAnchor    int64 = 0
+	selEnd       int64 = 0 // last selected element, valid if !selExtending
+)
+
+// 'v' key: starts a selection at the cursor, second press fixes its end
+func toggleSelection() {
+	if selExtending {
+		selEnd = cursor
+		selExtending = false
+		return
+	}
+	selActive = true
+	selExtending = true
+	selAnchor = cursor
+}
+
+// stops extending the selection, so the cursor can move without changing it
+func fixSelection() {
+	if selExtending {
+		selEnd = cursor
+		selExtending = false
+	}
+}
+
+func clearSelection() {
+	selActive = false
+	selExtending = false
+}
+
+// returns start and size of the selected range, ok is false if nothing is selected
+func selection() (start, size int64, ok bool) {
+	if !selActive {
+		return 0, 0, false
+	}
+	a, b := selAnchor, selEnd
+	if selExtending {
+		b = cursor
+	}
+	if a > b {
+		a, b = b, a
+	}
+	b += int64(elWidth) // include the whole last element
+	if b > fileSize {
+		b = fileSize
+	}
+	if a < 0 {
+		a = 0
+	}
+	if a >= b {
+		return 0, 0, false
+	}
+	return a, b - a, true
+}
+
+// is the byte at pos selected?
+func isSelected(pos int64) bool {
+	start, size, ok := selection()
+	return ok && pos >= start && pos < start+size
+}
+
+// selection if any, else size bytes from the cursor
+func selectionOr(size int64) (int64, int64) {
+	if start, ssize, ok := selection(); ok {
+		return start, ssize
+	}
+	return cursor, size
+}
+
+func selectRange(start, size int64) {
+	selActive = true
+	selExtending = false
+	selAnchor = start
+	selEnd = start + size - int64(elWidth)
+	if selEnd < start {
+		selEnd = start
+	}
+}
+
+// select [<start> <len>], start is an address like in goto
+func cmd_select(args string) {
+	a := cutArgs(args, 2)
+	switch len(a) {
+	case 0:
+		clearSelection()
+	case 2:
+		if start, size, ok := parseRange("select", a[0], a[1]); ok {
+			selectRange(start, size)
+		}
+	default:
+		showErrStr("select: need <start> <len>")
+	}
+}
+
+// write <file>: writes the selection to a file
+func cmd_write(args string) {
+	fname := strings.TrimSpace(args)
+	if fname == "" {
+		showErrStr("write: need file name")
+		return
+	}
+	start, size, ok := selection()
+	if !ok {
+		showErrStr("write: nothing selected")
+		return
+	}
+	if err := writeFile(fname, start, size); err != nil {
+		showError(err)
+		return
+	}
+	showMsg(fmt.Sprintf("written 0x%x bytes to %s", size, fname))
+}
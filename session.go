@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	MAX_SESSIONS = 256
+)
+
+// per-file viewer state, restored when the same file is opened again
+type Session struct {
+	Path    string
+	Size    int64
+	ModTime int64
+	Dev     uint64
+	Ino     uint64
+
+	Offset      int64
+	Cursor      int64
+	Cols        int64
+	CustomCols  bool
+	ElWidth     int
+	Base        int64
+	BaseMult    int64
+	ShowBin     bool
+	ShowHex     bool
+	ShowASCII   bool
+	ShowUnicode bool
+	DispMode    int
+	Dedup       bool
+	Bookmarks   [10]int64
+	AddrMap     string `json:",omitempty"` // "auto" or map file name
+
+	Ts int64
+}
+
+type SessionStore struct {
+	entries       []Session
+	fileTimestamp time.Time
+	fileSize      int64
+}
+
+var sessionStore = &SessionStore{}
+
+// identity of the currently opened file, filled by initSession()
+var curSession Session
+
+func (ss *SessionStore) fileName() string {
+	path, err := getAppDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(path, "sessions.json")
+}
+
+func (ss *SessionStore) Find(s *Session) *Session {
+	for i := len(ss.entries) - 1; i >= 0; i-- {
+		e := &ss.entries[i]
+		if e.Path == s.Path && e.Size == s.Size && e.ModTime == s.ModTime && e.Dev == s.Dev && e.Ino == s.Ino {
+			return e
+		}
+	}
+	return nil
+}
+
+func (ss *SessionStore) Put(s Session) {
+	s.Ts = time.Now().UnixNano()
+	ss.entries = append(ss.entries, s)
+	ss.sort_uniq()
+}
+
+func (ss *SessionStore) Save() {
+	fname := ss.fileName()
+	if fname == "" {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(fname), 0700)
+	if err != nil {
+		lastErrMsg = "[?] " + err.Error()
+		return
+	}
+
+	merged := ss
+
+	fi, err := os.Stat(fname)
+	if err == nil && (fi.ModTime() != ss.fileTimestamp || fi.Size() != ss.fileSize) {
+		merged = &SessionStore{}
+		merged.Load()
+		merged.entries = append(merged.entries, ss.entries...)
+		merged.sort_uniq()
+	}
+
+	entries := merged.entries
+	if len(merged.entries) > MAX_SESSIONS {
+		// keep last
+		entries = entries[len(merged.entries)-MAX_SESSIONS:]
+	}
+
+	f, err := os.Create(fname)
+	if err != nil {
+		lastErrMsg = "[?] " + err.Error()
+		return
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.Encode(entries)
+}
+
+// sort by timestamp and keep only the latest entry for each path
+func (ss *SessionStore) sort_uniq() {
+	sort.SliceStable(ss.entries, func(i, j int) bool {
+		return ss.entries[i].Ts < ss.entries[j].Ts
+	})
+
+	seen := make(map[string]bool)
+	uniq := make([]Session, 0, len(ss.entries))
+	for i := len(ss.entries) - 1; i >= 0; i-- {
+		if seen[ss.entries[i].Path] {
+			continue
+		}
+		seen[ss.entries[i].Path] = true
+		uniq = append(uniq, ss.entries[i])
+	}
+	for i, j := 0, len(uniq)-1; i < j; i, j = i+1, j-1 {
+		uniq[i], uniq[j] = uniq[j], uniq[i]
+	}
+	ss.entries = uniq
+}
+
+func (ss *SessionStore) Load() {
+	fname := ss.fileName()
+	if fname == "" {
+		return
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return
+	}
+
+	ss.fileTimestamp = fi.ModTime()
+	ss.fileSize = fi.Size()
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(&ss.entries); err != nil {
+		lastErrMsg = "[?] " + err.Error()
+	}
+}
+
+// fills curSession identity and restores the saved state, if any
+func initSession(path string, fi os.FileInfo) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	curSession.Path = absPath
+	curSession.Size = fileSize
+	curSession.ModTime = fi.ModTime().UnixNano()
+	curSession.Dev, curSession.Ino = fileIdentity(fi)
+
+	sessionStore.Load()
+	s := sessionStore.Find(&curSession)
+	if s == nil {
+		return
+	}
+
+	// explicitly passed options take precedence over the saved ones
+	if !explicitOffset {
+		offset = s.Offset
+		cursor = s.Cursor
+	}
+	if !pflag.CommandLine.Changed("cols") && s.CustomCols {
+		cols = s.Cols
+		customColsMode = true
+	}
+	if !pflag.CommandLine.Changed("base") {
+		base = s.Base
+	}
+	if !pflag.CommandLine.Changed("binary") {
+		showBin = s.ShowBin
+	}
+	if !pflag.CommandLine.Changed("hex") {
+		showHex = s.ShowHex
+	}
+	if !pflag.CommandLine.Changed("ascii") {
+		showASCII = s.ShowASCII
+	}
+	if !pflag.CommandLine.Changed("dedup") {
+		g_dedup = s.Dedup
+	}
+	if s.ElWidth > 0 {
+		elWidth = s.ElWidth
+	}
+	if s.BaseMult != 0 {
+		baseMult = s.BaseMult
+	}
+	showUnicode = s.ShowUnicode
+	if s.DispMode >= 0 && s.DispMode <= DispModeMax {
+		dispMode = s.DispMode
+	}
+	bookmarks = s.Bookmarks
+	if s.AddrMap != "" && addrMapFlag == "" {
+		loadAddrMap(s.AddrMap) // the map file may be gone, then there is no map
+	}
+}
+
+func saveSession() {
+	if curSession.Path == "" {
+		return
+	}
+
+	s := curSession
+	// the file may have been patched during the session
+	if fi, err := os.Stat(s.Path); err == nil && fi.Mode().IsRegular() {
+		s.Size = fi.Size()
+		s.ModTime = fi.ModTime().UnixNano()
+	}
+	s.Offset = offset
+	s.Cursor = cursor
+	s.Cols = cols
+	s.CustomCols = customColsMode
+	s.ElWidth = elWidth
+	s.Base = base
+	s.BaseMult = baseMult
+	s.ShowBin = showBin
+	s.ShowHex = showHex
+	s.ShowASCII = showASCII
+	s.ShowUnicode = showUnicode
+	s.DispMode = dispMode
+	s.Dedup = g_dedup
+	s.Bookmarks = bookmarks
+	s.AddrMap = addrMapSource
+
+	sessionStore.Put(s)
+	sessionStore.Save()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const STATS_TOP_BYTES = 16 // most common byte values shown
+
+// background scan counting the byte values, sparse holes are counted as zeros without reading them
+type statsScan struct {
+	mu        sync.Mutex
+	hist      [256]int64
+	start     int64
+	end       int64
+	pos       atomic.Int64
+	cancelled atomic.Bool
+	err       error
+	done      chan struct{}
+}
+
+func startStats(start, end int64) *statsScan {
+	s := &statsScan{start: start, end: end, done: make(chan struct{})}
+	s.pos.Store(start)
+
+	go func() {
+		defer close(s.done)
+		defer screen.PostEvent(tcell.NewEventInterrupt(nil))
+
+		buf := make([]byte, min64(end-start, bufSize))
+		lastRedraw := time.Now()
+		for pos := start; pos < end && !s.cancelled.Load(); {
+			if skip := findNextData(pos); skip != -1 {
+				skip = min64(skip, end)
+				s.mu.Lock()
+				s.hist[0] += skip - pos
+				s.mu.Unlock()
+				pos = skip
+				continue
+			}
+			// keep the chunks aligned, for block devices
+			n := min64((pos/bufSize+1)*bufSize, end) - pos
+			n2, err := reader.ReadAt(buf[:n], pos)
+			if err != nil && err != io.EOF {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+			var hist [256]int64
+			for _, c := range buf[:n2] {
+				hist[c]++
+			}
+			s.mu.Lock()
+			for i, cnt := range hist {
+				s.hist[i] += cnt
+			}
+			s.mu.Unlock()
+			pos += n
+			s.pos.Store(pos)
+			if time.Since(lastRedraw) >= progressInterval {
+				screen.PostEvent(tcell.NewEventInterrupt(nil))
+				lastRedraw = time.Now()
+			}
+		}
+	}()
+	return s
+}
+
+func (s *statsScan) Running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *statsScan) Cancel() {
+	s.cancelled.Store(true)
+	<-s.done
+}
+
+func (s *statsScan) Hist() [256]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hist
+}
+
+func (s *statsScan) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.Running():
+		pct := float64(s.pos.Load()-s.start) * 100 / float64(s.end-s.start)
+		return fmt.Sprintf("scanning %0*X %5.1f%%", offsetWidth, s.pos.Load(), pct)
+	case s.err != nil:
+		return "error: " + s.err.Error()
+	case s.cancelled.Load():
+		return "cancelled"
+	}
+	return "done"
+}
+
+// Shannon entropy in bits per byte, 0..8
+func entropy(hist *[256]int64, total int64) float64 {
+	h := 0.0
+	for _, cnt := range hist {
+		if cnt > 0 {
+			p := float64(cnt) / float64(total)
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func isTextByte(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c == '\t' || c == '\n' || c == '\r'
+}
+
+// rough class of the data, by the entropy and the kinds of bytes
+func classifyBytes(h float64, zeros, text, total int64) string {
+	switch {
+	case zeros*10 >= total*9:
+		return "mostly zeros"
+	case text*100 >= total*95:
+		return "text"
+	case h >= 7.9:
+		return "compressed or encrypted"
+	case h >= 7:
+		return "packed or compressed with headers"
+	}
+	return "binary data or code"
+}
+
+func percent(n, total int64) string {
+	return fmt.Sprintf("%10d %5.1f%%", n, float64(n)*100/float64(total))
+}
+
+func statsLines(hist *[256]int64, width int) []string {
+	total, zeros, text, ctrl, high := int64(0), hist[0], int64(0), int64(0), int64(0)
+	for c, cnt := range hist {
+		total += cnt
+		switch {
+		case isTextByte(byte(c)):
+			text += cnt
+		case c >= 0x80:
+			high += cnt
+		case c != 0:
+			ctrl += cnt
+		}
+	}
+	if total == 0 {
+		return []string{"no data yet"}
+	}
+
+	h := entropy(hist, total)
+	lines := []string{
+		fmt.Sprintf("bytes        %10d", total),
+		fmt.Sprintf("entropy      %10.4f bits/byte", h),
+		fmt.Sprintf("looks like   %s", classifyBytes(h, zeros, text, total)),
+		"zeros        " + percent(zeros, total),
+		"printable    " + percent(text, total) + "  (with tab, cr, lf)",
+		"control      " + percent(ctrl, total),
+		"high 80-ff   " + percent(high, total),
+		"",
+		"most common",
+	}
+
+	order := make([]int, 256)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return hist[order[i]] > hist[order[j]] })
+	for _, c := range order[:STATS_TOP_BYTES] {
+		if hist[c] == 0 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %02X %c  %s", c, ASCII_TBL[c], percent(hist[c], total)))
+	}
+
+	// histogram bars scaled to the most common value
+	lines = append(lines, "", "histogram")
+	max := hist[order[0]]
+	barWidth := max32(width-30, 10)
+	for c, cnt := range hist {
+		bar := int(cnt * int64(barWidth) / max)
+		if bar == 0 && cnt > 0 {
+			bar = 1
+		}
+		lines = append(lines, fmt.Sprintf("  %02X %c  %s %s", c, ASCII_TBL[c], percent(cnt, total), strings.Repeat("#", bar)))
+	}
+	return lines
+}
+
+// stats [<start> <len>], the selection or the whole file without arguments
+func cmd_stats(args string) {
+	start, size, ok := hashRange("stats", cutArgs(args, 2))
+	if !ok {
+		return
+	}
+
+	s := startStats(start, start+size)
+	defer s.Cancel()
+
+	title := fmt.Sprintf("stats %X+%X", offset2ea(start), size)
+	var lines []string
+	panel := &ListPanel{
+		Title: title,
+		Len: func() int {
+			hist := s.Hist()
+			lines = statsLines(&hist, scrWidth)
+			return len(lines)
+		},
+		Line:   func(i int) string { return lines[i] },
+		Status: s.Status,
+		Keys:   "w: write to file  esc: stop/close",
+	}
+	panel.Run(func(ev *tcell.EventKey, sel int) bool {
+		switch {
+		case ev.Key() == tcell.KeyEsc || ev.Key() == tcell.KeyCtrlC:
+			if s.Running() {
+				s.Cancel() // first Esc stops the scan, second closes the panel
+				return true
+			}
+		case ev.Key() == tcell.KeyRune && ev.Rune() == 'w':
+			if fname := askString("write to: ", "stats.txt"); fname != "" {
+				data := title + ", " + s.Status() + "\n" + strings.Join(lines, "\n") + "\n"
+				if err := os.WriteFile(fname, []byte(data), 0666); err != nil {
+					showError(err)
+				} else {
+					showMsg("written to " + fname)
+				}
+			}
+			return true
+		}
+		return false
+	})
+}
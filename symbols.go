@@ -0,0 +1,412 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	MAX_EXPORTS     = 65536 // sanity limit for the PE export directory
+	MIN_LABEL_WIDTH = 6     // labels are not shown in the dump if there is less room
+)
+
+type Symbol struct {
+	Name   string
+	Addr   uint64 // virtual address
+	Offset int64  // file offset, -1 if the symbol is not backed by the file
+	Kind   string // "section", "func", "object" or "symbol"
+	Pos    int64  // offset in the document, moved by insertions/deletions, set by remapSymbols()
+}
+
+var (
+	symbols       []Symbol       // sorted by offset
+	symbolsByName map[string]int // lowercase name -> index in symbols
+	symbolsFormat string         // "ELF", "PE", "Mach-O", empty if none
+)
+
+// virtual address range mapped to the file
+type vaMapping struct {
+	addr, size uint64
+	offset     int64
+}
+
+func mapVA(maps []vaMapping, va uint64) int64 {
+	for _, m := range maps {
+		if va >= m.addr && va-m.addr < m.size {
+			return m.offset + int64(va-m.addr)
+		}
+	}
+	return -1
+}
+
+// loads sections and symbols if r is an executable or object file
+func loadSymbols(r io.ReaderAt) {
+	defer func() {
+		// debug/* packages may panic on malformed files, then there are no symbols
+		if recover() != nil {
+			symbols, symbolsFormat, exeAddrMap = nil, "", nil
+		}
+	}()
+
+	var syms []Symbol
+	exeAddrMap = nil
+	if f, err := elf.NewFile(r); err == nil {
+		syms, symbolsFormat = loadELF(f), "ELF"
+	} else if f, err := pe.NewFile(r); err == nil {
+		syms, symbolsFormat = loadPE(f, r), "PE"
+	} else if f, err := macho.NewFile(r); err == nil {
+		syms, symbolsFormat = loadMachO(f, 0), "Mach-O"
+	} else if ff, err := macho.NewFatFile(r); err == nil && len(ff.Arches) > 0 {
+		syms, symbolsFormat = loadMachO(ff.Arches[0].File, int64(ff.Arches[0].Offset)), "Mach-O"
+	} else {
+		return
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool { return syms[i].Offset < syms[j].Offset })
+	symbols = syms
+	symbolsByName = make(map[string]int)
+	for i, s := range symbols {
+		name := strings.ToLower(s.Name)
+		if _, ok := symbolsByName[name]; !ok {
+			symbolsByName[name] = i
+		}
+		// Mach-O C symbols start with an underscore: "_main" is also "main"
+		if symbolsFormat == "Mach-O" && strings.HasPrefix(name, "_") {
+			if _, ok := symbolsByName[name[1:]]; !ok {
+				symbolsByName[name[1:]] = i
+			}
+		}
+	}
+	remapSymbols()
+}
+
+// document offsets of the symbols after insertions/deletions, a symbol deleted along with its bytes is at the deletion point.
+// Original pieces are in the file order, as are the symbols
+func remapSymbols() {
+	pieces := doc.Snapshot()
+	i, docStart := 0, int64(0)
+	origEnd, docEnd := int64(0), int64(0) // end of the last original piece before the symbol
+	for k := range symbols {
+		s := &symbols[k]
+		if s.Offset < 0 {
+			s.Pos = -1
+			continue
+		}
+		for i < len(pieces) && !(pieces[i].orig && pieces[i].start+pieces[i].size > s.Offset) {
+			if pieces[i].orig {
+				origEnd, docEnd = pieces[i].start+pieces[i].size, docStart+pieces[i].size
+			}
+			docStart += pieces[i].size
+			i++
+		}
+		switch {
+		case i == len(pieces):
+			s.Pos = min64(docEnd+s.Offset-origEnd, doc.Size())
+		case s.Offset >= pieces[i].start:
+			s.Pos = docStart + s.Offset - pieces[i].start
+		default:
+			// overwritten or deleted
+			s.Pos = min64(docEnd+s.Offset-origEnd, docStart)
+		}
+	}
+}
+
+func loadELF(f *elf.File) []Symbol {
+	syms := make([]Symbol, 0)
+	maps := make([]vaMapping, 0)
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			maps = append(maps, vaMapping{p.Vaddr, p.Filesz, int64(p.Off)})
+			if p.Filesz > 0 {
+				exeAddrMap = append(exeAddrMap, AddrRange{int64(p.Off), int64(p.Filesz), int64(p.Vaddr)})
+			}
+		}
+	}
+
+	for _, s := range f.Sections {
+		if s.Name == "" || s.Type == elf.SHT_NULL {
+			continue
+		}
+		off := int64(-1)
+		if s.Type != elf.SHT_NOBITS {
+			off = int64(s.Offset)
+		}
+		syms = append(syms, Symbol{s.Name, s.Addr, off, "section", 0})
+	}
+
+	static, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+	for _, s := range append(static, dynamic...) {
+		typ := elf.ST_TYPE(s.Info)
+		if s.Name == "" || s.Section == elf.SHN_UNDEF || s.Section >= elf.SHN_LORESERVE ||
+			typ == elf.STT_SECTION || typ == elf.STT_FILE {
+			continue
+		}
+		kind := "symbol"
+		switch typ {
+		case elf.STT_FUNC:
+			kind = "func"
+		case elf.STT_OBJECT:
+			kind = "object"
+		}
+
+		off := int64(-1)
+		if f.Type == elf.ET_REL {
+			// object files: values are relative to the section
+			if int(s.Section) < len(f.Sections) {
+				if sect := f.Sections[s.Section]; sect.Type != elf.SHT_NOBITS {
+					off = int64(sect.Offset + s.Value)
+				}
+			}
+		} else {
+			off = mapVA(maps, s.Value)
+		}
+		syms = append(syms, Symbol{s.Name, s.Value, off, kind, 0})
+	}
+	return syms
+}
+
+func loadPE(f *pe.File, r io.ReaderAt) []Symbol {
+	var imageBase uint64
+	var entry, headersSize uint32
+	var exportDir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase, entry, headersSize = uint64(oh.ImageBase), oh.AddressOfEntryPoint, oh.SizeOfHeaders
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+			exportDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	case *pe.OptionalHeader64:
+		imageBase, entry, headersSize = oh.ImageBase, oh.AddressOfEntryPoint, oh.SizeOfHeaders
+		if oh.NumberOfRvaAndSizes > pe.IMAGE_DIRECTORY_ENTRY_EXPORT {
+			exportDir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_EXPORT]
+		}
+	}
+
+	syms := make([]Symbol, 0)
+	maps := make([]vaMapping, 0)
+	if f.OptionalHeader != nil && headersSize > 0 {
+		exeAddrMap = append(exeAddrMap, AddrRange{0, int64(headersSize), int64(imageBase)})
+	}
+	for _, s := range f.Sections {
+		size := s.Size // raw data may be padded past the virtual size
+		if s.VirtualSize != 0 && s.VirtualSize < size {
+			size = s.VirtualSize
+		}
+		maps = append(maps, vaMapping{uint64(s.VirtualAddress), uint64(size), int64(s.Offset)})
+		if f.OptionalHeader != nil && s.Offset > 0 && size > 0 {
+			exeAddrMap = append(exeAddrMap, AddrRange{int64(s.Offset), int64(size), int64(imageBase) + int64(s.VirtualAddress)})
+		}
+		syms = append(syms, Symbol{s.Name, imageBase + uint64(s.VirtualAddress), int64(s.Offset), "section", 0})
+	}
+	rva2sym := func(name string, rva uint32, kind string) Symbol {
+		return Symbol{name, imageBase + uint64(rva), mapVA(maps, uint64(rva)), kind, 0}
+	}
+
+	if entry != 0 {
+		syms = append(syms, rva2sym("entry", entry, "func"))
+	}
+
+	// COFF symbols, usually only in object files and debug builds
+	for _, s := range f.Symbols {
+		if s.SectionNumber <= 0 || int(s.SectionNumber) > len(f.Sections) || s.Name == "" {
+			continue
+		}
+		if s.StorageClass == 3 && s.Value == 0 && strings.HasPrefix(s.Name, ".") {
+			continue // section symbol
+		}
+		kind := "symbol"
+		if s.Type&0x30 == 0x20 { // IMAGE_SYM_DTYPE_FUNCTION
+			kind = "func"
+		}
+		sect := f.Sections[s.SectionNumber-1]
+		if f.OptionalHeader == nil {
+			// object file: values are relative to the section data
+			syms = append(syms, Symbol{s.Name, uint64(s.Value), int64(sect.Offset + s.Value), kind, 0})
+		} else {
+			syms = append(syms, rva2sym(s.Name, sect.VirtualAddress+s.Value, kind))
+		}
+	}
+
+	return append(syms, loadPEExports(r, maps, exportDir, rva2sym)...)
+}
+
+// exported functions by name, from IMAGE_EXPORT_DIRECTORY
+func loadPEExports(r io.ReaderAt, maps []vaMapping, dir pe.DataDirectory, rva2sym func(string, uint32, string) Symbol) []Symbol {
+	syms := make([]Symbol, 0)
+	// up to size bytes
+	readAt := func(rva uint32, size int) []byte {
+		off := mapVA(maps, uint64(rva))
+		if off < 0 {
+			return nil
+		}
+		buf := make([]byte, size)
+		n, _ := r.ReadAt(buf, off)
+		return buf[:n]
+	}
+
+	hdr := readAt(dir.VirtualAddress, 40)
+	if dir.VirtualAddress == 0 || len(hdr) < 40 {
+		return syms
+	}
+	le := binary.LittleEndian
+	numFuncs, numNames := le.Uint32(hdr[20:]), le.Uint32(hdr[24:])
+	if numNames > MAX_EXPORTS || numFuncs > MAX_EXPORTS {
+		return syms
+	}
+	funcs := readAt(le.Uint32(hdr[28:]), int(numFuncs)*4)
+	names := readAt(le.Uint32(hdr[32:]), int(numNames)*4)
+	ordinals := readAt(le.Uint32(hdr[36:]), int(numNames)*2)
+	if len(funcs) < int(numFuncs)*4 || len(names) < int(numNames)*4 || len(ordinals) < int(numNames)*2 {
+		return syms
+	}
+	for i := 0; i < int(numNames); i++ {
+		ord := le.Uint16(ordinals[i*2:])
+		if uint32(ord) >= numFuncs {
+			continue
+		}
+		rva := le.Uint32(funcs[int(ord)*4:])
+		if rva >= dir.VirtualAddress && rva < dir.VirtualAddress+dir.Size {
+			continue // forwarded to another dll
+		}
+		name := readAt(le.Uint32(names[i*4:]), 256)
+		if end := strings.IndexByte(string(name), 0); end > 0 {
+			syms = append(syms, rva2sym(string(name[:end]), rva, "func"))
+		}
+	}
+	return syms
+}
+
+// base is the offset of the file in a fat binary
+func loadMachO(f *macho.File, base int64) []Symbol {
+	syms := make([]Symbol, 0)
+	maps := make([]vaMapping, 0)
+	for _, l := range f.Loads {
+		if s, ok := l.(*macho.Segment); ok && s.Filesz > 0 {
+			maps = append(maps, vaMapping{s.Addr, s.Filesz, base + int64(s.Offset)})
+			exeAddrMap = append(exeAddrMap, AddrRange{base + int64(s.Offset), int64(s.Filesz), int64(s.Addr)})
+		}
+	}
+
+	for _, s := range f.Sections {
+		off := int64(-1)
+		if s.Offset != 0 {
+			off = base + int64(s.Offset)
+		}
+		syms = append(syms, Symbol{s.Seg + "." + strings.TrimPrefix(s.Name, "__"), s.Addr, off, "section", 0})
+	}
+
+	if f.Symtab != nil {
+		for _, s := range f.Symtab.Syms {
+			const N_STAB, N_TYPE, N_SECT = 0xe0, 0x0e, 0x0e
+			if s.Name == "" || s.Type&N_STAB != 0 || s.Type&N_TYPE != N_SECT {
+				continue
+			}
+			kind := "symbol"
+			if int(s.Sect) >= 1 && int(s.Sect) <= len(f.Sections) && f.Sections[s.Sect-1].Name == "__text" {
+				kind = "func"
+			}
+			syms = append(syms, Symbol{s.Name, s.Value, mapVA(maps, s.Value), kind, 0})
+		}
+	}
+	return syms
+}
+
+// value of a symbol name in expressions
+func lookupSymbol(name string) (int64, bool, error) {
+	i, ok := symbolsByName[name]
+	if !ok {
+		return 0, false, nil
+	}
+	if symbols[i].Pos < 0 {
+		return 0, true, fmt.Errorf("not in the file (address %X)", symbols[i].Addr)
+	}
+	return offset2ea(symbols[i].Pos), true, nil
+}
+
+// first symbol starting in [pos, pos+size), for labels in the dump
+func symbolAt(pos, size int64) (Symbol, bool) {
+	i := sort.Search(len(symbols), func(i int) bool { return symbols[i].Pos >= pos })
+	if i < len(symbols) && symbols[i].Pos < pos+size {
+		return symbols[i], true
+	}
+	return Symbol{}, false
+}
+
+// nearest symbol at or before pos, for the status line
+func symbolBefore(pos int64) (Symbol, bool) {
+	i := sort.Search(len(symbols), func(i int) bool { return symbols[i].Pos > pos })
+	if i > 0 && symbols[i-1].Pos >= 0 {
+		return symbols[i-1], true
+	}
+	return Symbol{}, false
+}
+
+func symbolLine(s Symbol) string {
+	off := "-"
+	if s.Pos >= 0 {
+		off = fmt.Sprintf("%0*X", offsetWidth, offset2ea(s.Pos))
+	}
+	return fmt.Sprintf("%*s  %16X  %-7s %s", offsetWidth, off, s.Addr, s.Kind, s.Name)
+}
+
+// list of symbols, '/' filters by name, Enter goes to the symbol
+func showSymbols(filter string) {
+	if len(symbols) == 0 {
+		showErrStr("no symbols")
+		return
+	}
+
+	var list []Symbol
+	panel := &ListPanel{
+		Len:  func() int { return len(list) },
+		Line: func(i int) string { return symbolLine(list[i]) },
+		Keys: "enter: go  /: filter  esc: close",
+	}
+	applyFilter := func() {
+		list = make([]Symbol, 0)
+		for _, s := range symbols {
+			if strings.Contains(strings.ToLower(s.Name), strings.ToLower(filter)) {
+				list = append(list, s)
+			}
+		}
+		panel.Title = fmt.Sprintf("symbols (%s)", symbolsFormat)
+		if filter != "" {
+			panel.Title += ": " + filter
+		}
+		panel.sel, panel.top = 0, 0
+	}
+	applyFilter()
+
+	for {
+		i := panel.Run(func(ev *tcell.EventKey, sel int) bool {
+			if ev.Key() == tcell.KeyRune && ev.Rune() == '/' {
+				str, key := ask("filter: ", filter, "", false)
+				if key != tcell.KeyEsc && key != tcell.KeyCtrlC {
+					filter = str
+					applyFilter()
+				}
+				return true
+			}
+			return false
+		})
+		if i < 0 {
+			return
+		}
+		if list[i].Pos < 0 {
+			showErrStr(list[i].Name + ": not in the file")
+			continue
+		}
+		pushBreadcrumb(-1)
+		setCursor(list[i].Pos)
+		return
+	}
+}
@@ -14,6 +14,12 @@ var (
 	stGray = tcell.StyleDefault.Foreground(tcell.NewRGBColor(0x30, 0x30, 0x30))
 	stErr  = tcell.StyleDefault.Foreground(tcell.NewRGBColor(0xFF, 0x00, 0x00))
 
+	stModified = tcell.StyleDefault.Foreground(tcell.NewRGBColor(0xFF, 0xA0, 0x00))
+	stLabel    = tcell.StyleDefault.Foreground(tcell.NewRGBColor(0x40, 0xA0, 0xFF))
+	stUnmapped = tcell.StyleDefault.Foreground(tcell.NewRGBColor(0x80, 0x80, 0x80))
+
+	colSelection = tcell.NewRGBColor(0x20, 0x40, 0x80)
+
 	showBin     bool = false
 	showHex     bool = true
 	showASCII   bool = true
@@ -81,8 +87,30 @@ func draw() {
 	nextOffset = fileHexDump(reader, maxLinesPerPage)
 
 	printAtSt(0, maxLinesPerPage, ":", stGray)
-	shortname := shortenFName(fname, scrWidth-10)
-	printAtSt(scrWidth-utf8.RuneCountInString(shortname), maxLinesPerPage, shortname, stGray)
+	status := fmt.Sprintf("%0*X  %s", offsetWidth, offset2ea(cursor), shortenFName(fname, scrWidth-offsetWidth-20))
+	if s, ok := symbolBefore(cursor); ok {
+		status = fmt.Sprintf("%s+%X  ", s.Name, cursor-s.Pos) + status
+	}
+	if doc.Modified() {
+		status = "[+] " + status
+	}
+	if start, size, ok := selection(); ok {
+		status = fmt.Sprintf("sel %X+%X  ", offset2ea(start), size) + status
+	}
+	if macroRecReg != "" {
+		status = "rec @" + macroRecReg + "  " + status
+	}
+	if editMode {
+		if editInsert {
+			status = "INS " + status
+		}
+		if editColumn == EditColHex {
+			status = "EDIT hex  " + status
+		} else {
+			status = "EDIT text " + status
+		}
+	}
+	printAtSt(scrWidth-utf8.RuneCountInString(status), maxLinesPerPage, status, stGray)
 
 	if len(lastErrMsg) > 0 {
 		printAtSt(0, maxLinesPerPage, lastErrMsg, stErr)
@@ -128,17 +156,45 @@ func calcDefaultCols(scrWidth int) {
 	cols = int64(max_w)
 }
 
-func printAtBytes(x, y int, msg []byte) {
+// pos is the file offset of msg[0], used for highlighting the cursor
+func printAtBytes(x, y int, msg []byte, pos int64) {
 	for i, c := range msg {
 		if x+i >= scrWidth {
 			break
 		}
 		st := tcell.StyleDefault
-		if c < 0x20 {
+		if doc.IsModified(pos + int64(i)) {
+			st = stModified
+		} else if c < 0x20 {
 			st = stGray
 		}
-		screen.SetCell(x+i, y, st, ASCII_TBL[c])
+		if pos+int64(i) == cursor {
+			st = st.Reverse(true)
+		}
+		screen.SetCell(x+i, y, selStyle(st, pos+int64(i)), ASCII_TBL[c])
+	}
+}
+
+// prints string decoded by decodeUTF16LE/BE, highlighting the char under the cursor
+func printAtUTF16(x, y int, msg string, pos int64) int {
+	i := 0
+	for _, c := range msg {
+		if x+i >= scrWidth {
+			break
+		}
+		size := int64(2)
+		if c > 0xffff {
+			size = 4 // surrogate pair
+		}
+		st := tcell.StyleDefault
+		if cursor >= pos && cursor < pos+size {
+			st = st.Reverse(true)
+		}
+		screen.SetCell(x+i, y, selStyle(st, pos), c)
+		pos += size
+		i++
 	}
+	return i
 }
 
 func clearLine(y int) {
@@ -191,8 +247,10 @@ func ask(prompt, curValue, allowedChars string, firstKey bool, termKeys ...tcell
 		})
 		screen.Show()
 
-		ev := screen.PollEvent()
+		ev := pollEvent()
 		switch ev := ev.(type) {
+		case *macroCmdEvent:
+			stopMacroAtCmd(ev)
 		case *tcell.EventKey:
 			if len(termKeys) > 0 {
 				for _, key := range termKeys {
@@ -245,10 +303,17 @@ func ask(prompt, curValue, allowedChars string, firstKey bool, termKeys ...tcell
 	}
 }
 
+// also stops a macro, anything failing beeps
 func beep() {
+	stopMacro("stopped")
 	screen.Beep()
 }
 
+func confirm(prompt string) bool {
+	str, _ := ask(prompt, "", "yYnN", true)
+	return strings.ToLower(str) == "y"
+}
+
 func askString(prompt, curValue string) string {
 	str, _ := ask(prompt, curValue, "", true)
 	return str
@@ -266,7 +331,7 @@ func askInt(prompt string, curValue int64) int64 {
 	}
 	n, err := parseExpr(str)
 	if err != nil {
-		beep()
+		showError(err)
 		return curValue
 	}
 	return n
@@ -287,13 +352,13 @@ func askOffset(prompt string, curValue int64) int64 {
 		newOffset := (n * fileSize) / 100
 		if elWidth > 1 {
 			newOffset -= newOffset % int64(elWidth) // align to element size
-			newOffset += offset % int64(elWidth)    // keep current offset alignment
+			newOffset += cursor % int64(elWidth)    // keep current cursor alignment
 		}
 		return newOffset
 	}
 	n, err := parseExprRadix(strings.ToLower(str), 16)
 	if err != nil {
-		beep()
+		showError(err)
 		return curValue
 	}
 	return n
@@ -306,7 +371,7 @@ func askHexInt(prompt string, curValue int64) int64 {
 	}
 	n, err := parseExprRadix(strings.ToLower(str), 16)
 	if err != nil {
-		beep()
+		showError(err)
 		return curValue
 	}
 	return n
@@ -332,63 +397,180 @@ func checkInterrupt() bool {
 
 func waitForAnyKey() {
 	for {
-		ev := screen.PollEvent()
-		switch ev.(type) {
+		switch ev := pollEvent().(type) {
+		case *macroCmdEvent:
+			stopMacroAtCmd(ev)
 		case *tcell.EventKey:
 			return
 		}
 	}
 }
 
-var g_searchMode = 0
+var (
+	g_searchMode  = SearchModeHex
+	g_searchFlags = 0 // Text* options of SearchModeText, Num* options of SearchModeNumber
+	g_patchMode   = SearchModeHex
+)
 
-func askPattern(prefix string, pattern0 []byte) []byte {
+// asks for a pattern, *mode is one of SearchMode* up to maxMode, switched by Tab.
+// If flags is not nil, text options can be changed: Ctrl-N toggles case sensitivity, Ctrl-T switches encodings
+func askPattern(prefix string, mode, flags *int, maxMode int, pattern0 []byte) []byte {
 	var key tcell.Key
 	var str string
 
+	noFlags := 0
+	if flags == nil {
+		flags = &noFlags
+	}
+
 	firstKey := true
 	pattern := pattern0
+	if *mode > maxMode {
+		*mode = SearchModeText
+	}
+	allowedHex := HEX_CHARS + " "
+	if maxMode >= SearchModeHexMask {
+		allowedHex += "?[-]"
+	}
 	for {
-		if g_searchMode == 0 {
-			pattern_str := strings.TrimSpace(toHex(pattern, int64(scrWidth/3), 1))
-			str, key = ask(prefix+"hex : ", pattern_str, "0123456789abcdefABCDEF ", firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown)
+		switch *mode {
+		case SearchModeHex, SearchModeHexMask:
+			pattern_str := string(pattern)
+			if *mode == SearchModeHex {
+				pattern_str = strings.TrimSpace(toHex(pattern, int64(scrWidth/3), 1))
+			}
+			str, key = ask(prefix+"hex : ", pattern_str, allowedHex, firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown)
 			if key == tcell.KeyEnter {
-				pattern = fromHex(str)
-				searchHistory.Add(g_searchMode, pattern)
+				// patterns with wildcards are kept as text
+				if isHexMask(str) {
+					if _, err := parseHexMask(str); err != nil {
+						showError(err)
+						return nil
+					}
+					*mode = SearchModeHexMask
+					pattern = []byte(strings.TrimSpace(str))
+				} else {
+					*mode = SearchModeHex
+					pattern = fromHex(str)
+				}
+				searchHistory.Add(*mode, 0, pattern)
 				return pattern
 			}
-		} else {
-			pattern_str := string(pattern)
-			str, key = ask(prefix+"text: ", pattern_str, "", firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown)
+		case SearchModeMulti:
+			str, key = ask(prefix+"any of: ", string(pattern), "", firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown)
+			if key == tcell.KeyEnter {
+				pattern = []byte(str)
+				if _, _, err := parseMultiPatterns(str); err != nil {
+					showError(err)
+					return nil
+				}
+				searchHistory.Add(*mode, 0, pattern)
+				return pattern
+			}
+		case SearchModeNumber:
+			str, key = ask(prefix+"number["+numFlagsString(*flags)+"]: ", string(pattern), NUM_CHARS, firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown, tcell.KeyCtrlT, tcell.KeyCtrlE, tcell.KeyCtrlA)
+			if key == tcell.KeyEnter {
+				pattern = []byte(str)
+				if _, err := newNumberMatcher(str, *flags); err != nil {
+					showError(err)
+					return nil
+				}
+				searchHistory.Add(*mode, *flags&NUM_FLAGS, pattern)
+				return pattern
+			}
+			pattern = []byte(str)
+		case SearchModeRegex:
+			str, key = ask(prefix+"regex: ", string(pattern), "", firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown)
+			if key == tcell.KeyEnter {
+				pattern = []byte(str)
+				if _, err := newRegexMatcher(str); err != nil {
+					showError(err)
+					return nil
+				}
+				searchHistory.Add(*mode, 0, pattern)
+				return pattern
+			}
+		default:
+			label := "text: "
+			if *flags&TEXT_FLAGS != 0 {
+				label = "text[" + textFlagsString(*flags) + "]: "
+			}
+			str, key = ask(prefix+label, string(pattern), "", firstKey, tcell.KeyTab, tcell.KeyUp, tcell.KeyDown, tcell.KeyCtrlN, tcell.KeyCtrlT)
 			if key == tcell.KeyEnter {
 				pattern = []byte(str)
-				searchHistory.Add(g_searchMode, pattern)
+				searchHistory.Add(*mode, *flags&TEXT_FLAGS, pattern)
 				return pattern
 			}
+			pattern = []byte(str)
 		}
 		switch key {
 		case tcell.KeyEsc, tcell.KeyCtrlC:
 			// cancel search
 			return nil
+		case tcell.KeyCtrlN:
+			if flags != &noFlags {
+				*flags ^= TextIgnoreCase
+			}
+			firstKey = false
+		case tcell.KeyCtrlT:
+			// switch encodings, or number types
+			if *mode == SearchModeNumber {
+				*flags = nextNumType(*flags)
+			} else if flags != &noFlags {
+				enc := *flags & (TextUTF16LE | TextUTF16BE | TextUTF8)
+				i := 0
+				for i < len(TEXT_ENCODINGS) && TEXT_ENCODINGS[i] != enc {
+					i++
+				}
+				*flags = *flags&^enc | TEXT_ENCODINGS[(i+1)%len(TEXT_ENCODINGS)]
+			}
+			firstKey = false
+		case tcell.KeyCtrlE:
+			*flags ^= NumBigEndian
+			firstKey = false
+		case tcell.KeyCtrlA:
+			*flags ^= NumAligned
+			firstKey = false
 		case tcell.KeyTab:
 			// switch search mode
-			g_searchMode = 1 - g_searchMode
+			if *mode == SearchModeHexMask {
+				*mode = SearchModeHex
+			}
+			*mode += 1
+			if *mode == SearchModeHexMask {
+				*mode += 1
+			}
+			if *mode > maxMode {
+				*mode = 0
+			}
 		case tcell.KeyUp:
 			// prev history
-			prevMode, prevPattern := searchHistory.Prev()
-			if prevPattern != nil {
-				g_searchMode = prevMode
-				pattern = prevPattern
+			e := searchHistory.Prev()
+			for e != nil && e.Mode > maxMode {
+				e = searchHistory.Prev()
+			}
+			if e != nil {
+				*mode = e.Mode
+				if flags != &noFlags {
+					*flags = e.Flags
+				}
+				pattern = e.Pattern
 				firstKey = false
 			} else {
 				beep()
 			}
 		case tcell.KeyDown:
 			// next history
-			nextMode, nextPattern := searchHistory.Next()
-			if nextPattern != nil {
-				g_searchMode = nextMode
-				pattern = nextPattern
+			e := searchHistory.Next()
+			for e != nil && e.Mode > maxMode {
+				e = searchHistory.Next()
+			}
+			if e != nil {
+				*mode = e.Mode
+				if flags != &noFlags {
+					*flags = e.Flags
+				}
+				pattern = e.Pattern
 				firstKey = false
 			} else {
 				if bytes.Equal(pattern, pattern0) {
@@ -411,12 +593,22 @@ func askCommand() string {
 
 	firstKey := true
 	for {
-		cmd, key = ask("command: ", cmd, "", firstKey, tcell.KeyUp, tcell.KeyDown)
+		cmd, key = ask("command: ", cmd, "", firstKey, tcell.KeyUp, tcell.KeyDown, tcell.KeyTab)
 		if key == tcell.KeyEnter {
+			// ambiguous command name: choose one instead of an error
+			name := strings.SplitN(cmd, " ", 2)[0]
+			if names, exact := matchCommands(name); !exact && len(names) > 1 {
+				cmd = completeLine(cmd, len(name))
+				firstKey = false
+				continue
+			}
 			commandHistory.Add(cmd)
 			return cmd
 		}
 		switch key {
+		case tcell.KeyTab:
+			cmd = completeLine(cmd, len(cmd))
+			firstKey = false
 		case tcell.KeyEsc, tcell.KeyCtrlC:
 			// cancel command
 			return ""
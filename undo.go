@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	MAX_UNDO_ENTRIES    = 1024
+	MAX_UNDO_CHUNK_SIZE = 64 * 1024 * 1024  // bigger writes are not undoable
+	MAX_UNDO_BYTES      = 256 * 1024 * 1024 // old and new data of all the entries, the oldest entries are dropped
+)
+
+type UndoChunk struct {
+	Offset int64
+	Old    []byte
+	New    []byte
+}
+
+// one undo step: either a direct write to the file, which may touch several ranges (i.e. saving pending changes),
+// or a change of the document, kept as its pieces before and after
+type UndoEntry struct {
+	OnDisk bool
+	Chunks []UndoChunk
+	Ts     int64
+
+	Before []Piece `json:"-"`
+	After  []Piece `json:"-"`
+}
+
+type UndoJournal struct {
+	entries []UndoEntry
+	pos     int  // number of applied entries, entries[pos:] can be redone
+	merge   bool // next pending edit may be merged into the last entry
+}
+
+type undoJournalFile struct {
+	Path    string
+	Entries []UndoEntry
+}
+
+var (
+	undoJournal = &UndoJournal{}
+	persistUndo = true
+)
+
+func (e *UndoEntry) dataSize() int64 {
+	size := int64(0)
+	for _, c := range e.Chunks {
+		size += int64(len(c.Old) + len(c.New))
+	}
+	return size
+}
+
+func (j *UndoJournal) add(e UndoEntry) {
+	e.Ts = time.Now().UnixNano()
+	j.entries = append(j.entries[:j.pos], e)
+	if len(j.entries) > MAX_UNDO_ENTRIES {
+		j.entries = j.entries[len(j.entries)-MAX_UNDO_ENTRIES:]
+	}
+	total := int64(0)
+	for i := range j.entries {
+		total += j.entries[i].dataSize()
+	}
+	for len(j.entries) > 1 && total > MAX_UNDO_BYTES {
+		total -= j.entries[0].dataSize()
+		j.entries = j.entries[1:]
+	}
+	j.pos = len(j.entries)
+}
+
+// records a change of the document, must be called after the change.
+// Consecutive typing is merged into a single entry
+func (j *UndoJournal) RecordDoc(before []Piece, typing bool) {
+	if typing && j.merge && j.pos > 0 && j.pos == len(j.entries) && !j.entries[j.pos-1].OnDisk {
+		j.entries[j.pos-1].After = doc.Snapshot()
+		return
+	}
+	j.add(UndoEntry{Before: before, After: doc.Snapshot()})
+	j.merge = typing
+}
+
+// records a direct write to the file, must be called before the write
+func (j *UndoJournal) RecordDisk(chunks []UndoChunk) {
+	j.add(UndoEntry{OnDisk: true, Chunks: chunks})
+	j.merge = false
+	j.persist()
+}
+
+// after a failed write, the last entry keeps only what reached the file:
+// the chunks before chunks[i] and n bytes of it
+func (j *UndoJournal) KeepWritten(chunks []UndoChunk, i int, n int64) {
+	j.Drop()
+	kept := append([]UndoChunk{}, chunks[:i]...)
+	if n > 0 {
+		c := chunks[i]
+		kept = append(kept, UndoChunk{c.Offset, c.Old[:n], c.New[:n]})
+	}
+	if len(kept) > 0 {
+		j.RecordDisk(kept)
+	}
+}
+
+// forgets the last recorded entry, i.e. when the write has failed
+func (j *UndoJournal) Drop() {
+	if j.pos > 0 && j.pos == len(j.entries) {
+		onDisk := j.entries[j.pos-1].OnDisk
+		j.pos--
+		j.entries = j.entries[:j.pos]
+		if onDisk {
+			j.persist()
+		}
+	}
+}
+
+func (j *UndoJournal) Undo() error {
+	j.merge = false
+	if j.pos == 0 {
+		return errors.New("nothing to undo")
+	}
+	e := &j.entries[j.pos-1]
+	if !e.OnDisk {
+		doc.Restore(e.Before)
+		docChanged()
+	}
+	for i := len(e.Chunks) - 1; i >= 0; i-- {
+		c := e.Chunks[i]
+		if err := applyUndoChunk(c.Offset, c.New, c.Old); err != nil {
+			return err
+		}
+	}
+	j.pos--
+	if e.OnDisk {
+		j.persist()
+	}
+	return nil
+}
+
+func (j *UndoJournal) Redo() error {
+	j.merge = false
+	if j.pos >= len(j.entries) {
+		return errors.New("nothing to redo")
+	}
+	e := &j.entries[j.pos]
+	if !e.OnDisk {
+		doc.Restore(e.After)
+		docChanged()
+	}
+	for _, c := range e.Chunks {
+		if err := applyUndoChunk(c.Offset, c.Old, c.New); err != nil {
+			return err
+		}
+	}
+	j.pos++
+	if e.OnDisk {
+		j.persist()
+	}
+	return nil
+}
+
+// replaces cur with data at offset in the file
+func applyUndoChunk(offset int64, cur, data []byte) error {
+	if !allowWrite {
+		return errors.New(ERR_WRITE_NOT_ALLOWED)
+	}
+	if !doc.IsIdentity() {
+		return errNotIdentity
+	}
+	// don't overwrite what was changed by someone else
+	buf := make([]byte, len(cur))
+	if n, _ := doc.Reader.ReadAt(buf, offset); n != len(buf) || !bytes.Equal(buf, cur) {
+		return fmt.Errorf("file was changed at %x, refusing to undo", offset)
+	}
+	if _, err := writeAt(offset, data); err != nil {
+		return err
+	}
+	doc.Revert(offset, int64(len(data)))
+	return nil
+}
+
+func (j *UndoJournal) fileName() string {
+	path, err := getAppDir()
+	if err != nil || curSession.Path == "" {
+		return ""
+	}
+	return filepath.Join(path, "undo", fmt.Sprintf("%x.json", sha1.Sum([]byte(curSession.Path))))
+}
+
+// saves applied disk writes, so they can be rolled back after a crash
+func (j *UndoJournal) persist() {
+	if !persistUndo {
+		return
+	}
+	fname := j.fileName()
+	if fname == "" {
+		return
+	}
+	if err := j.save(fname); err != nil {
+		lastErrMsg = "[?] undo journal: " + err.Error()
+	}
+}
+
+// the journal is written to a temp file and renamed, so a crash leaves either the old or the new one
+func (j *UndoJournal) save(fname string) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+
+	jf := undoJournalFile{Path: curSession.Path}
+	for _, e := range j.entries[:j.pos] {
+		if e.OnDisk {
+			jf.Entries = append(jf.Entries, e)
+		}
+	}
+
+	if len(jf.Entries) == 0 {
+		if err := os.Remove(fname); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fname), filepath.Base(fname)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails after the rename
+	if err := json.NewEncoder(f).Encode(jf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fname)
+}
+
+// loads disk writes of previous sessions, they can be undone if the file still has the written data
+func initUndoJournal() {
+	if !persistUndo {
+		return
+	}
+	fname := undoJournal.fileName()
+	if fname == "" {
+		return
+	}
+	f, err := os.Open(fname)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var jf undoJournalFile
+	dec := json.NewDecoder(f)
+	if err := dec.Decode(&jf); err != nil {
+		lastErrMsg = "[?] " + err.Error()
+		return
+	}
+	if jf.Path != curSession.Path {
+		return
+	}
+	undoJournal.entries = jf.Entries
+	undoJournal.pos = len(jf.Entries)
+}
+
+// reads original (not modified in the document) file data
+func readOriginal(offset, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := doc.Reader.ReadAt(buf, offset)
+	if int64(n) != size {
+		if err == nil {
+			err = errors.New("short read")
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func undo() {
+	if err := undoJournal.Undo(); err != nil {
+		showError(err)
+	}
+}
+
+func redo() {
+	if err := undoJournal.Redo(); err != nil {
+		showError(err)
+	}
+}
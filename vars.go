@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// variables defined by :let, names are lowercase as the expressions are
+var userVars = make(map[string]int64)
+
+func isVarName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordChar(name[i]) {
+			return false
+		}
+	}
+	_, isFunc := DEREF_FUNCS[name]
+	return !isFunc
+}
+
+func isHexNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune(HEX_CHARS, rune(s[i])) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func setUserVar(name, expr string) bool {
+	name = strings.ToLower(name)
+	// numbers take precedence in the expressions
+	if isHexNumber(name) {
+		showErrStr("invalid variable name: ", name, " (a hex number)")
+		return false
+	}
+	if !isVarName(name) {
+		showErrStr("invalid variable name: " + name)
+		return false
+	}
+	val, err := parseExprRadix(expr, 16)
+	if err != nil {
+		showError(err)
+		return false
+	}
+	userVars[name] = val
+	return true
+}
+
+// value of a name in an expression: user variable, INT_VARS, fileSize, selection bounds, bookmark (@1..@0) or symbol.
+// ok is false if there is no such name, so it may be a number
+func lookupExprName(name string) (val int64, ok bool, err error) {
+	if v, ok := userVars[name]; ok {
+		return v, true, nil
+	}
+	for _, v := range INT_VARS {
+		if strings.EqualFold(v.name, name) {
+			switch p := v.pvar.(type) {
+			case *int64:
+				return *p, true, nil
+			case *bool:
+				return b2i(*p), true, nil
+			}
+		}
+	}
+	switch name {
+	case "filesize":
+		return fileSize, true, nil
+	case "selstart", "selend":
+		start, size, ok := selection()
+		if !ok {
+			return 0, true, errors.New("no selection")
+		}
+		if name == "selend" {
+			start += size
+		}
+		return offset2ea(start), true, nil
+	}
+	if len(name) == 2 && name[0] == '@' && name[1] >= '0' && name[1] <= '9' {
+		return offset2ea(bookmarks[name[1]-'0']), true, nil
+	}
+	return lookupSymbol(name)
+}
+
+// let <name> = <expr>
+func cmd_let(args string) {
+	name, expr, ok := strings.Cut(args, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !ok || name == "" || expr == "" {
+		showErrStr("let: need <name> = <expr>")
+		return
+	}
+	setUserVar(name, expr)
+}
+
+// variables with their values, for :set without arguments
+func listVars() []string {
+	lines := make([]string, 0)
+	for _, v := range INT_VARS {
+		switch p := v.pvar.(type) {
+		case *int64:
+			if v.defaultRadix == 16 {
+				lines = append(lines, fmt.Sprintf("%-16s 0x%x", v.name, *p))
+			} else {
+				lines = append(lines, fmt.Sprintf("%-16s %d", v.name, *p))
+			}
+		case *bool:
+			lines = append(lines, fmt.Sprintf("%-16s %v", v.name, *p))
+		}
+	}
+
+	names := make([]string, 0, len(userVars))
+	for name := range userVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := userVars[name]
+		lines = append(lines, fmt.Sprintf("%-16s 0x%x (%d)", name, v, v))
+	}
+
+	lines = append(lines, fmt.Sprintf("%-16s 0x%x (%d)", "fileSize", fileSize, fileSize))
+	if start, size, ok := selection(); ok {
+		lines = append(lines, fmt.Sprintf("%-16s 0x%x", "selStart", offset2ea(start)))
+		lines = append(lines, fmt.Sprintf("%-16s 0x%x", "selEnd", offset2ea(start+size)))
+	}
+	for i := 1; i <= 10; i++ {
+		n := i % 10
+		lines = append(lines, fmt.Sprintf("%-16s 0x%x", fmt.Sprintf("@%d", n), offset2ea(bookmarks[n])))
+	}
+	return lines
+}
+
+func showVars() {
+	lines := listVars()
+	panel := &ListPanel{
+		Title: "variables",
+		Len:   func() int { return len(lines) },
+		Line:  func(i int) string { return lines[i] },
+		Keys:  ":let name = expr to define  esc: close",
+	}
+	panel.Run(func(ev *tcell.EventKey, sel int) bool { return false })
+}